@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jbub/foxesscloud_exporter/internal/collector"
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/server"
+
+	"github.com/oklog/run"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+)
+
+var Replay = &cli.Command{
+	Name:  "replay",
+	Usage: "Starts exporter server fed by recorded API responses.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "dir",
+			Usage:    "Directory with the recorded API responses.",
+			EnvVars:  []string{"REPLAY_DIR"},
+			Required: true,
+		},
+		&cli.Float64Flag{
+			Name:    "speed",
+			Usage:   "Replay speed relative to the recorded time, 0 replays as fast as possible.",
+			EnvVars: []string{"REPLAY_SPEED"},
+			Value:   1,
+		},
+	},
+	Action: runReplay,
+}
+
+func runReplay(ctx *cli.Context) error {
+	cfg := config.LoadFromCLI(ctx)
+	// replayed data must not overwrite the state of a running exporter
+	cfg.StateFile = ""
+
+	log, err := newLogger(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("could not create logger: %v", err)
+	}
+
+	exp, err := collector.New(cfg, log)
+	if err != nil {
+		return fmt.Errorf("could not create exporter: %v", err)
+	}
+
+	var g run.Group
+
+	replayCtx, cancel := context.WithCancel(context.Background())
+	g.Add(func() error {
+		if err := exp.Replay(replayCtx, ctx.String("dir"), ctx.Float64("speed")); err != nil {
+			return fmt.Errorf("could not replay: %w", err)
+		}
+		log.Info("Replay finished")
+		<-replayCtx.Done()
+		return nil
+	}, func(err error) {
+		cancel()
+	})
+
+	srv := server.New(cfg, exp)
+	g.Add(func() error {
+		return srv.Run()
+	}, func(err error) {
+		_ = srv.Shutdown(context.Background())
+	})
+
+	log.Info("Starting replay",
+		zap.String("dir", ctx.String("dir")),
+		zap.Float64("speed", ctx.Float64("speed")),
+		zap.String("listen_addr", cfg.ListenAddress),
+	)
+
+	return g.Run()
+}
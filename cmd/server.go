@@ -3,15 +3,20 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net/http"
 
-	"github.com/jbub/foxesscloud"
 	"github.com/jbub/foxesscloud_exporter/internal/collector"
 	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/modbus"
+	"github.com/jbub/foxesscloud_exporter/internal/openapi"
+	"github.com/jbub/foxesscloud_exporter/internal/otlp"
+	"github.com/jbub/foxesscloud_exporter/internal/recorder"
 	"github.com/jbub/foxesscloud_exporter/internal/server"
 
 	"github.com/oklog/run"
 	"github.com/prometheus/common/version"
 	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -29,20 +34,91 @@ func runServer(ctx *cli.Context) error {
 		return fmt.Errorf("could not create logger: %v", err)
 	}
 
-	client, err := foxesscloud.NewClient(foxesscloud.Config{
-		Token:     cfg.APIToken,
-		UserAgent: collector.Name,
-	})
-	if err != nil {
-		return fmt.Errorf("could not create client: %v", err)
+	otlpCfg := otlp.Config{
+		Endpoint:       cfg.OTLPEndpoint,
+		Protocol:       cfg.OTLPProtocol,
+		Headers:        cfg.OTLPHeaders,
+		Insecure:       cfg.OTLPInsecure,
+		CAFile:         cfg.OTLPCAFile,
+		CertFile:       cfg.OTLPCertFile,
+		KeyFile:        cfg.OTLPKeyFile,
+		Interval:       cfg.OTLPInterval,
+		ServiceName:    collector.Name,
+		ServiceVersion: version.Version,
+		Attributes:     config.ParseLabels(cfg.DefaultLabels),
+	}
+
+	if cfg.APIToken == "" && len(cfg.APIAccounts) == 0 {
+		return fmt.Errorf("api token or accounts must be defined")
+	}
+	if cfg.APIToken == "" && len(cfg.Inverters) > 0 {
+		return fmt.Errorf("inverters require api token")
+	}
+
+	if err := openapi.ValidateBaseURL(cfg.APIURL); err != nil {
+		return fmt.Errorf("invalid api url: %v", err)
+	}
+	httpClient := &http.Client{}
+
+	if cfg.RecordDir != "" {
+		rec, err := recorder.New(recorder.Config{
+			Dir:         cfg.RecordDir,
+			MaxFileSize: cfg.RecordMaxSize,
+			MaxFiles:    cfg.RecordMaxFiles,
+		})
+		if err != nil {
+			return fmt.Errorf("could not create recorder: %v", err)
+		}
+		defer rec.Close()
+
+		httpClient = &http.Client{
+			Transport: rec.Transport(httpClient.Transport),
+		}
+	}
+
+	if cfg.OTLPEndpoint != "" && cfg.OTLPTraces {
+		provider, err := otlp.NewTracerProvider(context.Background(), otlpCfg)
+		if err != nil {
+			return fmt.Errorf("could not create tracer provider: %v", err)
+		}
+		defer func() {
+			if err := provider.Shutdown(context.Background()); err != nil {
+				log.Error("could not shutdown tracer provider", zap.Error(err))
+			}
+		}()
+		otel.SetTracerProvider(provider)
+
+		httpClient = &http.Client{
+			Transport: openapi.NewTracingTransport(httpClient.Transport),
+		}
+
+		log.Info("Starting OTLP traces export",
+			zap.String("endpoint", cfg.OTLPEndpoint),
+			zap.String("protocol", cfg.OTLPProtocol),
+		)
 	}
 
 	var g run.Group
 
-	exp, err := collector.New(cfg, log, client)
+	exp, err := collector.New(cfg, log)
 	if err != nil {
 		return fmt.Errorf("could not create exporter: %v", err)
 	}
+	if cfg.MetricNaming != config.MetricNamingV2 {
+		log.Warn("Legacy metric names are deprecated, migrate to the v2 metric naming", zap.String("metric_naming", cfg.MetricNaming))
+	}
+
+	httpClient = &http.Client{
+		Transport: exp.Transport(httpClient.Transport),
+	}
+
+	if cfg.APIToken != "" {
+		exp.AddAccount(config.DefaultAccount, newAPIClient(httpClient, cfg.APIURL, cfg.APIToken))
+	}
+
+	for name, token := range cfg.APIAccounts {
+		exp.AddAccount(name, newAPIClient(httpClient, cfg.APIURL, token))
+	}
 
 	g.Add(func() error {
 		return exp.Start()
@@ -50,6 +126,38 @@ func runServer(ctx *cli.Context) error {
 		exp.Shutdown()
 	})
 
+	if cfg.OTLPEndpoint != "" && cfg.OTLPMetrics {
+		provider, err := otlp.NewMeterProvider(context.Background(), otlpCfg)
+		if err != nil {
+			return fmt.Errorf("could not create meter provider: %v", err)
+		}
+		defer func() {
+			if err := provider.Shutdown(context.Background()); err != nil {
+				log.Error("could not shutdown meter provider", zap.Error(err))
+			}
+		}()
+
+		if err := exp.RegisterMeter(provider.Meter(collector.Name)); err != nil {
+			return fmt.Errorf("could not register meter: %v", err)
+		}
+
+		log.Info("Starting OTLP metrics export",
+			zap.String("endpoint", cfg.OTLPEndpoint),
+			zap.String("protocol", cfg.OTLPProtocol),
+		)
+	}
+
+	if cfg.ModbusAddress != "" {
+		mbSrv := modbus.NewServer(exp.ModbusHandler())
+		g.Add(func() error {
+			return mbSrv.ListenAndServe(cfg.ModbusAddress)
+		}, func(err error) {
+			_ = mbSrv.Close()
+		})
+
+		log.Info("Starting Modbus server", zap.String("listen_addr", cfg.ModbusAddress))
+	}
+
 	srv := server.New(cfg, exp)
 	g.Add(func() error {
 		return srv.Run()
@@ -66,6 +174,15 @@ func runServer(ctx *cli.Context) error {
 	return g.Run()
 }
 
+func newAPIClient(httpClient *http.Client, baseURL string, token string) *openapi.Client {
+	return openapi.NewClient(openapi.Config{
+		Client:    httpClient,
+		BaseURL:   baseURL,
+		Token:     token,
+		UserAgent: collector.Name,
+	})
+}
+
 func newLogger(level string) (*zap.Logger, error) {
 	lvl, err := zap.ParseAtomicLevel(level)
 	if err != nil {
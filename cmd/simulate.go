@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/fakeapi"
+	"github.com/jbub/foxesscloud_exporter/internal/modbus"
+
+	"github.com/oklog/run"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+)
+
+var Simulate = &cli.Command{
+	Name:  "simulate",
+	Usage: "Starts fake Fox ESS API server serving simulated inverter data.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "listen-address",
+			Usage:   "Address on which to expose the fake API.",
+			EnvVars: []string{"SIMULATE_LISTEN_ADDRESS"},
+			Value:   ":9562",
+		},
+		&cli.Float64Flag{
+			Name:    "peak-power",
+			Usage:   "Photovoltaic power in kW produced at noon.",
+			EnvVars: []string{"SIMULATE_PEAK_POWER"},
+			Value:   5,
+		},
+		&cli.IntFlag{
+			Name:    "strings",
+			Usage:   "Number of simulated PV strings.",
+			EnvVars: []string{"SIMULATE_STRINGS"},
+			Value:   2,
+		},
+		&cli.StringFlag{
+			Name:    "timezone",
+			Usage:   "Timezone of the simulated site.",
+			EnvVars: []string{"SIMULATE_TIMEZONE"},
+			Value:   "UTC",
+		},
+		&cli.Float64Flag{
+			Name:    "fault-probability",
+			Usage:   "Probability of an inverter reporting a fault in a 30 minute window.",
+			EnvVars: []string{"SIMULATE_FAULT_PROBABILITY"},
+			Value:   0.05,
+		},
+		&cli.Float64Flag{
+			Name:    "rate-limit-probability",
+			Usage:   "Probability of a request failing with a rate limit error.",
+			EnvVars: []string{"SIMULATE_RATE_LIMIT_PROBABILITY"},
+		},
+		&cli.StringFlag{
+			Name:    "modbus-listen-address",
+			Usage:   "Address on which to expose simulated inverters over Modbus TCP, unit ids are assigned in order starting at 1. Empty disables Modbus.",
+			EnvVars: []string{"SIMULATE_MODBUS_LISTEN_ADDRESS"},
+		},
+	},
+	Action: runSimulate,
+}
+
+func runSimulate(ctx *cli.Context) error {
+	cfg := config.LoadFromCLI(ctx)
+	log, err := newLogger(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("could not create logger: %v", err)
+	}
+
+	loc, err := time.LoadLocation(ctx.String("timezone"))
+	if err != nil {
+		return fmt.Errorf("could not load timezone: %v", err)
+	}
+
+	api := fakeapi.New(fakeapi.Config{
+		Token:                cfg.APIToken,
+		Inverters:            cfg.Inverters,
+		Location:             loc,
+		PeakPower:            ctx.Float64("peak-power"),
+		Strings:              ctx.Int("strings"),
+		FaultProbability:     ctx.Float64("fault-probability"),
+		RateLimitProbability: ctx.Float64("rate-limit-probability"),
+	})
+
+	var g run.Group
+
+	srv := &http.Server{
+		Addr:              ctx.String("listen-address"),
+		Handler:           api,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	g.Add(func() error {
+		return srv.ListenAndServe()
+	}, func(err error) {
+		_ = srv.Shutdown(context.Background())
+	})
+
+	if addr := ctx.String("modbus-listen-address"); addr != "" {
+		regs := modbus.NewRegisters()
+		mbSrv := modbus.NewServer(regs)
+		done := make(chan struct{})
+
+		g.Add(func() error {
+			tick := time.NewTicker(time.Second)
+			defer tick.Stop()
+			for {
+				now := time.Now()
+				for i, inverterSN := range cfg.Inverters {
+					regs.Set(byte(i+1), modbus.EncodeVariables(api.Readings(inverterSN, now), modbus.FoxESSRegisters))
+				}
+				select {
+				case <-tick.C:
+				case <-done:
+					return nil
+				}
+			}
+		}, func(err error) {
+			close(done)
+		})
+
+		g.Add(func() error {
+			return mbSrv.ListenAndServe(addr)
+		}, func(err error) {
+			_ = mbSrv.Close()
+		})
+
+		log.Info("Starting simulated Modbus server", zap.String("listen_addr", addr))
+	}
+
+	log.Info("Starting fake API",
+		zap.String("listen_addr", srv.Addr),
+		zap.Strings("inverters", cfg.Inverters),
+	)
+
+	return g.Run()
+}
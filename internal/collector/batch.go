@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/openapi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// fetchInverterBatch fetches the inverters in a single API request, the results and errors are in the order
+// of the inverters. Inverters missing in the response or failing with the whole batch fall back to the local source.
+func (e *Exporter) fetchInverterBatch(ctx context.Context, acc account, inverterSNs []string) ([]metricData, []error) {
+	ctx, span := e.tracer.Start(ctx, "fetch inverter batch", trace.WithAttributes(attribute.StringSlice(inverterSNLabel, inverterSNs)))
+	defer span.End()
+
+	res := make([]metricData, len(inverterSNs))
+	errs := make([]error, len(inverterSNs))
+
+	items, err := e.fetchInverterBatchData(ctx, acc, inverterSNs)
+	if err != nil {
+		recordError(span, err)
+	}
+
+	for i, inverterSN := range inverterSNs {
+		d, ok := items[inverterSN]
+		if ok {
+			res[i] = d
+			continue
+		}
+
+		cloudErr := err
+		if cloudErr == nil {
+			cloudErr = fmt.Errorf("no data")
+		}
+		res[i], errs[i] = e.fetchLocalFallback(ctx, inverterSN, cloudErr)
+	}
+	return res, errs
+}
+
+func (e *Exporter) fetchInverterBatchData(ctx context.Context, acc account, inverterSNs []string) (map[string]metricData, error) {
+	if err := e.limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("could not wait for rate limit: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	e.logger(ctx).Debug("fetching inverter batch data", zap.Strings("inverter_sns", inverterSNs))
+
+	variables := e.requestVariables(inverterSNs...)
+	e.usage.record(time.Now())
+	// fault codes are requested along so they do not need a separate request
+	request := append(slices.Clip(variables), foxesscloud.VariableCurrentFault)
+	e.payload.addRequest(inverterSNs, request)
+	data, err := acc.api.GetRealtimeDataBatch(ctx, inverterSNs, request)
+	if err != nil {
+		return nil, err
+	}
+
+	e.logger(ctx).Debug("fetched inverter batch data", zap.Strings("inverter_sns", inverterSNs), zap.Int("num_items", len(data)))
+
+	res := make(map[string]metricData, len(data))
+	for _, item := range data {
+		reported := make([]foxesscloud.Variable, 0, len(item.Datas))
+		for _, dataItem := range item.Datas {
+			reported = append(reported, dataItem.Variable)
+		}
+		e.checkVariables(ctx, item.DeviceSN, variables, reported)
+
+		d := newMetricDataFromAPI(item.DeviceSN, item, e.units)
+		// the fault codes are part of the batch response, the previous faults are only used when they are missing
+		if d.FaultCount > 0 && !hasVariable(item, foxesscloud.VariableCurrentFault) {
+			d.Faults = e.previousFaults(item.DeviceSN)
+		}
+		res[item.DeviceSN] = d
+	}
+	return res, nil
+}
+
+// newMetricDataFromAPI converts realtime data decoded by the openapi client, values which are not numbers
+// are skipped except for the fault codes.
+func newMetricDataFromAPI(inverterSN string, item openapi.RealtimeData, units *unitNormaliser) metricData {
+	d := metricData{
+		InverterSN: inverterSN,
+		Source:     sourceCloud,
+		UpdateTime: item.Time.Time,
+		Variables:  make(map[foxesscloud.Variable]bool),
+	}
+	for _, dataItem := range item.Datas {
+		if dataItem.Variable == foxesscloud.VariableCurrentFault {
+			d.Faults = parseFaults(dataItem.String())
+			d.Variables[dataItem.Variable] = true
+			continue
+		}
+		value, err := strconv.ParseFloat(dataItem.String(), 64)
+		if err != nil {
+			continue
+		}
+		d.setVariable(dataItem.Variable, units.normalise(dataItem.Variable, dataItem.Unit, value))
+	}
+	return d
+}
+
+func hasVariable(item openapi.RealtimeData, variable foxesscloud.Variable) bool {
+	for _, dataItem := range item.Datas {
+		if dataItem.Variable == variable {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// number of recent update periods and delays used to estimate the upstream refresh
+	cadenceHistory = 5
+)
+
+func duplicateReadingsDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_duplicate_readings_total", "Number of fetched readings with unchanged update time.", nil, constLabels)
+}
+
+// inverterCadence tracks how often the cloud refreshes the realtime data of an inverter.
+type inverterCadence struct {
+	lastUpdate time.Time
+	// periods between successive update times
+	periods []time.Duration
+	// delays between the update time and the fetch which first saw it
+	delays     []time.Duration
+	duplicates float64
+}
+
+type cadenceTracker struct {
+	mu        sync.Mutex
+	inverters map[string]*inverterCadence
+}
+
+func newCadenceTracker() *cadenceTracker {
+	return &cadenceTracker{
+		inverters: make(map[string]*inverterCadence),
+	}
+}
+
+// observe records the update time of a reading fetched at fetchedAt.
+func (t *cadenceTracker) observe(inverterSN string, updateTime time.Time, fetchedAt time.Time) {
+	if updateTime.IsZero() {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.inverters[inverterSN]
+	if !ok {
+		c = &inverterCadence{}
+		t.inverters[inverterSN] = c
+	}
+
+	switch {
+	case updateTime.Equal(c.lastUpdate):
+		c.duplicates++
+		return
+	case updateTime.Before(c.lastUpdate):
+		return
+	}
+
+	if !c.lastUpdate.IsZero() {
+		c.periods = appendRecent(c.periods, updateTime.Sub(c.lastUpdate))
+		c.delays = appendRecent(c.delays, max(fetchedAt.Sub(updateTime), 0))
+	}
+	c.lastUpdate = updateTime
+}
+
+// expectedUpdate returns when the next refresh of the inverter data is expected to be available. The medians
+// of the recent periods and delays are used, so that a single early or late refresh does not move the estimate.
+func (t *cadenceTracker) expectedUpdate(inverterSN string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.inverters[inverterSN]
+	if !ok || len(c.periods) == 0 {
+		return time.Time{}, false
+	}
+	return c.lastUpdate.Add(median(c.periods) + median(c.delays)), true
+}
+
+func median(values []time.Duration) time.Duration {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	n := len(sorted)
+	if n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[n/2]
+}
+
+func (t *cadenceTracker) duplicates(inverterSN string) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c, ok := t.inverters[inverterSN]; ok {
+		return c.duplicates
+	}
+	return 0
+}
+
+func appendRecent(values []time.Duration, value time.Duration) []time.Duration {
+	values = append(values, value)
+	if len(values) > cadenceHistory {
+		values = values[len(values)-cadenceHistory:]
+	}
+	return values
+}
+
+func (e *Exporter) observeReadings(data map[string]metricData, fetchedAt time.Time) {
+	for inverterSN, d := range data {
+		if d.Source == sourceCloud {
+			e.cadence.observe(inverterSN, d.UpdateTime, fetchedAt)
+		}
+	}
+}
+
+func (e *Exporter) collectCadence(metrics chan<- prometheus.Metric) {
+	for _, inverterSN := range e.inverters {
+		labels := e.buildLabels(inverterSN, sourceCloud)
+		metrics <- prometheus.MustNewConstMetric(duplicateReadingsDesc(labels), prometheus.CounterValue, e.cadence.duplicates(inverterSN))
+	}
+}
@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCadenceExpectedUpdate(t *testing.T) {
+	c := newCadenceTracker()
+	if _, ok := c.expectedUpdate("sn-1"); ok {
+		t.Fatal("expected no estimate without readings")
+	}
+
+	// a single early refresh must not move the estimate
+	offsets := []time.Duration{0, 5, 10, 11, 16, 21}
+	delays := []time.Duration{time.Second * 30, time.Second * 20, time.Second * 30, time.Second * 10, time.Minute * 2, time.Second * 40}
+	var last time.Time
+	for i, offset := range offsets {
+		last = testNow.Add(offset * time.Minute)
+		c.observe("sn-1", last, last.Add(delays[i]))
+	}
+	c.observe("sn-1", last, last.Add(time.Minute))
+
+	got, ok := c.expectedUpdate("sn-1")
+	if !ok {
+		t.Fatal("expected estimate")
+	}
+	if want := last.Add(time.Minute*5 + time.Second*30); !got.Equal(want) {
+		t.Errorf("expected update at %v, got %v", want, got)
+	}
+	if d := c.duplicates("sn-1"); d != 1 {
+		t.Errorf("expected 1 duplicate reading, got %v", d)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []time.Duration
+		want   time.Duration
+	}{
+		{values: []time.Duration{3}, want: 3},
+		{values: []time.Duration{5, 1, 3}, want: 3},
+		{values: []time.Duration{4, 1, 3, 2}, want: 2},
+	}
+	for _, test := range tests {
+		if got := median(test.values); got != test.want {
+			t.Errorf("%v: expected %v, got %v", test.values, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dcPower returns the sum of the PV string powers in kW.
+func dcPower(data metricData) float64 {
+	var res float64
+	for _, s := range data.PVStrings {
+		res += s.Power
+	}
+	return res
+}
+
+// hasStringPower reports whether the power of at least one PV string is reported in the data.
+func hasStringPower(data metricData) bool {
+	if data.Variables == nil {
+		return len(data.PVStrings) > 0
+	}
+	for n := 1; n <= maxPVStrings; n++ {
+		if data.Variables[pvStringVariable(n, pvStringPower)] {
+			return true
+		}
+	}
+	return false
+}
+
+// efficiencyMetrics returns the DC to AC conversion metrics of the inverter. They are present only when the power
+// of the PV strings is reported, the DC power is at least minPower in kW, because the readings are too noisy at low
+// power, and the output power does not exceed it, e.g. when a battery is discharging.
+func efficiencyMetrics(minPower float64, threshold float64) []metric {
+	present := func(data metricData) bool {
+		if !hasStringPower(data) {
+			return false
+		}
+		dc := dcPower(data)
+		return dc >= minPower && dc > 0 && data.OutputPower >= 0 && data.OutputPower <= dc
+	}
+	loss := func(data metricData) float64 {
+		return dcPower(data) - data.OutputPower
+	}
+	efficiency := func(data metricData) float64 {
+		return data.OutputPower / dcPower(data)
+	}
+	variables := []foxesscloud.Variable{foxesscloud.VariableGenerationPower}
+	// the DC power sums all PV strings, the inverter reports only the installed ones
+	var stringVariables []foxesscloud.Variable
+	for n := 1; n <= maxPVStrings; n++ {
+		stringVariables = append(stringVariables, pvStringVariable(n, pvStringPower))
+	}
+
+	return []metric{
+		{
+			name:              "inverter_efficiency_ratio",
+			help:              "Ratio of the AC output power to the DC power of the PV strings.",
+			valType:           prometheus.GaugeValue,
+			eval:              efficiency,
+			variables:         variables,
+			optionalVariables: stringVariables,
+			present:           present,
+			unit:              unitRatio,
+		},
+		{
+			name:              "inverter_conversion_loss_power_kw",
+			help:              "DC power of the PV strings lost in the conversion to AC output power.",
+			valType:           prometheus.GaugeValue,
+			eval:              loss,
+			variables:         variables,
+			optionalVariables: stringVariables,
+			present:           present,
+			naming:            config.MetricNamingLegacy,
+		},
+		{
+			name:              "inverter_conversion_loss_power_watts",
+			help:              "DC power of the PV strings lost in the conversion to AC output power in watts.",
+			valType:           prometheus.GaugeValue,
+			eval:              func(data metricData) float64 { return loss(data) * wattsPerKW },
+			variables:         variables,
+			optionalVariables: stringVariables,
+			present:           present,
+			naming:            config.MetricNamingV2,
+			unit:              unitWatts,
+		},
+		{
+			name:              "inverter_efficiency_low",
+			help:              "Whether the inverter efficiency is below the expected efficiency threshold.",
+			valType:           prometheus.GaugeValue,
+			eval:              func(data metricData) float64 { return boolToFloat(efficiency(data) < threshold) },
+			variables:         variables,
+			optionalVariables: stringVariables,
+			present:           present,
+		},
+	}
+}
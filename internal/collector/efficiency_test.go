@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+)
+
+func TestEfficiencyMetricsAvailable(t *testing.T) {
+	reading := func(output float64, variables ...foxesscloud.Variable) metricData {
+		d := metricData{Variables: make(map[foxesscloud.Variable]bool)}
+		d.setVariable(foxesscloud.VariableGenerationPower, output)
+		for _, variable := range variables {
+			d.setVariable(variable, 1.5)
+		}
+		return d
+	}
+	tests := []struct {
+		name string
+		data metricData
+		want bool
+	}{
+		{name: "string powers", data: reading(2.7, foxesscloud.VariablePv1Power, foxesscloud.VariablePv2Power), want: true},
+		// strings known from their voltage and current only have zero power
+		{name: "no string power", data: reading(0, foxesscloud.VariablePv1Volt, foxesscloud.VariablePv1Current)},
+		{name: "output above string power", data: reading(3.5, foxesscloud.VariablePv1Power, foxesscloud.VariablePv2Power)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, m := range efficiencyMetrics(0.3, 0.9) {
+				if got := m.available(test.data); got != test.want {
+					t.Errorf("%v: expected available %v, got %v", m.name, test.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestConversionLossNaming(t *testing.T) {
+	tests := []struct {
+		naming string
+		want   map[string]string
+	}{
+		{naming: config.MetricNamingLegacy, want: map[string]string{"inverter_conversion_loss_power_kw": ""}},
+		{naming: config.MetricNamingV2, want: map[string]string{"inverter_conversion_loss_power_watts": unitWatts}},
+		{naming: config.MetricNamingBoth, want: map[string]string{"inverter_conversion_loss_power_kw": "", "inverter_conversion_loss_power_watts": unitWatts}},
+	}
+	for _, test := range tests {
+		t.Run(test.naming, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.MetricNaming = test.naming
+			got := make(map[string]string)
+			for _, m := range buildMetrics(cfg) {
+				if m.name != "inverter_conversion_loss_power_kw" && m.name != "inverter_conversion_loss_power_watts" {
+					continue
+				}
+				if _, ok := got[m.name]; ok {
+					t.Errorf("%v: metric defined more than once", m.name)
+				}
+				got[m.name] = m.unit
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("expected %v, got %v", test.want, got)
+			}
+			for name, unit := range test.want {
+				if got[name] != unit {
+					t.Errorf("%v: expected unit %q, got %q", name, unit, got[name])
+				}
+			}
+		})
+	}
+}
+
+func TestEfficiencyStringVariables(t *testing.T) {
+	for _, naming := range []string{config.MetricNamingLegacy, config.MetricNamingV2} {
+		t.Run(naming, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.MetricNaming = naming
+			variables := requiredVariables(buildMetrics(cfg))
+			for n := 1; n <= maxPVStrings; n++ {
+				if variable := pvStringVariable(n, pvStringPower); !slices.Contains(variables, variable) {
+					t.Errorf("expected %v to be requested", variable)
+				}
+			}
+		})
+	}
+}
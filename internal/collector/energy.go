@@ -0,0 +1,221 @@
+package collector
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+)
+
+const (
+	// number of consecutive readings lower than the last one after which the lower value is accepted as the new baseline
+	maxGlitchReadings = 3
+)
+
+// dailyEnergyCounter turns an energy value that resets every midnight (in the inverter's timezone)
+// into a monotonic counter by accumulating the deltas between successive readings.
+type dailyEnergyCounter struct {
+	Initialized bool      `json:"initialized"`
+	Last        float64   `json:"last"`
+	LastTime    time.Time `json:"last_time"`
+	Total       float64   `json:"total"`
+	Drops       int       `json:"drops"`
+}
+
+func (c *dailyEnergyCounter) observe(value float64, ts time.Time) float64 {
+	if !c.Initialized {
+		c.Initialized = true
+		c.Last = value
+		c.LastTime = ts
+		return c.Total
+	}
+
+	// readings older than the last one are out of order, skip them
+	if ts.Before(c.LastTime) {
+		return c.Total
+	}
+
+	delta := value - c.Last
+	switch {
+	case delta >= 0:
+		c.Total += delta
+	case !sameDay(c.LastTime, ts):
+		// the value was reset at midnight, everything generated since then is new energy
+		c.Total += value
+	default:
+		// the value dropped within the same day, this is most likely an API glitch, keep the last good value
+		// so that the energy is not counted twice once the value recovers
+		c.Drops++
+		if c.Drops < maxGlitchReadings {
+			return c.Total
+		}
+	}
+
+	c.Drops = 0
+	c.Last = value
+	c.LastTime = ts
+	return c.Total
+}
+
+func sameDay(a, b time.Time) bool {
+	b = b.In(a.Location())
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// powerIntegrator integrates instantaneous power readings in kW over time into energy in kWh
+// using the trapezoidal rule, intervals longer than the max gap are not integrated.
+type powerIntegrator struct {
+	Initialized bool      `json:"initialized"`
+	LastPower   float64   `json:"last_power"`
+	LastTime    time.Time `json:"last_time"`
+	Total       float64   `json:"total"`
+}
+
+func (p *powerIntegrator) observe(power float64, ts time.Time, maxGap time.Duration) float64 {
+	// the counter has to stay monotonic, negative power does not add any energy
+	power = max(power, 0)
+
+	if !p.Initialized {
+		p.Initialized = true
+		p.LastPower = power
+		p.LastTime = ts
+		return p.Total
+	}
+
+	// skip duplicate and out of order readings
+	elapsed := ts.Sub(p.LastTime)
+	if elapsed <= 0 {
+		return p.Total
+	}
+	if elapsed <= maxGap {
+		p.Total += (p.LastPower + power) / 2 * elapsed.Hours()
+	}
+
+	p.LastPower = power
+	p.LastTime = ts
+	return p.Total
+}
+
+type integratedPower struct {
+	name     string
+	help     string
+	power    func(data metricData) float64
+	variable foxesscloud.Variable
+	// pvString is the number of the integrated PV string, zero for other powers
+	pvString int
+}
+
+func integratedPowers() []integratedPower {
+	res := []integratedPower{
+		{
+			name:     "photovoltaic",
+			help:     "Photovoltaic energy integrated by the exporter from photovoltaic power.",
+			power:    func(data metricData) float64 { return data.PhotovoltaicPower },
+			variable: foxesscloud.VariablePvPower,
+		},
+		{
+			name:     "load",
+			help:     "Load energy integrated by the exporter from load power.",
+			power:    func(data metricData) float64 { return data.LoadPower },
+			variable: foxesscloud.VariableLoadsPower,
+		},
+		{
+			name:     "feed_in",
+			help:     "Feed-in energy integrated by the exporter from feed-in power.",
+			power:    func(data metricData) float64 { return data.FeedInPower },
+			variable: foxesscloud.VariableFeedinPower,
+		},
+		{
+			name:     "output",
+			help:     "Output energy integrated by the exporter from output power.",
+			power:    func(data metricData) float64 { return data.OutputPower },
+			variable: foxesscloud.VariableGenerationPower,
+		},
+		{
+			name:     "grid_consumption",
+			help:     "Grid consumption energy integrated by the exporter from grid consumption power.",
+			power:    func(data metricData) float64 { return data.GridConsumptionPower },
+			variable: foxesscloud.VariableGridConsumptionPower,
+		},
+	}
+	for n := 1; n <= maxPVStrings; n++ {
+		res = append(res, integratedPower{
+			name:     fmt.Sprintf("pv%d", n),
+			help:     fmt.Sprintf("PV%d energy integrated by the exporter from PV%d power.", n, n),
+			power:    func(data metricData) float64 { return data.PVStrings[n].Power },
+			variable: pvStringVariable(n, pvStringPower),
+			pvString: n,
+		})
+	}
+	return res
+}
+
+// exposedPowers returns the integrated powers whose variable the metrics are computed from, e.g. the legacy naming
+// does not expose the PV strings above the fourth.
+func exposedPowers(metrics []metric) []integratedPower {
+	return slices.DeleteFunc(integratedPowers(), func(ip integratedPower) bool {
+		return !slices.ContainsFunc(metrics, func(m metric) bool { return slices.Contains(m.variables, ip.variable) })
+	})
+}
+
+type inverterEnergy struct {
+	Generated  dailyEnergyCounter          `json:"generated"`
+	Integrated map[string]*powerIntegrator `json:"integrated"`
+	// Day is the time of the first reading of the current day, DayStart holds the integrated energy at that time
+	Day      time.Time          `json:"day"`
+	DayStart map[string]float64 `json:"day_start"`
+}
+
+func newInverterEnergy() *inverterEnergy {
+	return &inverterEnergy{
+		Integrated: make(map[string]*powerIntegrator),
+	}
+}
+
+func (e *Exporter) updateEnergy(data []metricData) {
+	e.energyMu.Lock()
+	defer e.energyMu.Unlock()
+
+	for i := range data {
+		e.updateInverterEnergy(data[i].InverterSN, &data[i])
+	}
+}
+
+// updateInverterEnergy updates the energy state stored under the key with the reading, the lock has to be held.
+func (e *Exporter) updateInverterEnergy(key string, d *metricData) {
+	energy, ok := e.energy[key]
+	if !ok {
+		energy = newInverterEnergy()
+		e.energy[key] = energy
+	}
+	// missing variables are not observed, their zero values would be taken for readings
+	d.GeneratedEnergyTotal = energy.Generated.Total
+	if d.reported(foxesscloud.VariableTodayYield) {
+		d.GeneratedEnergyTotal = energy.Generated.observe(d.TodayGeneratedPower, d.UpdateTime)
+	}
+
+	newDay := d.UpdateTime.After(energy.Day) && !sameDay(energy.Day, d.UpdateTime)
+	if newDay {
+		energy.Day = d.UpdateTime
+		energy.DayStart = make(map[string]float64, len(e.integrated))
+	}
+
+	d.IntegratedEnergy = make(map[string]float64, len(e.integrated))
+	d.TodayEnergy = make(map[string]float64, len(e.integrated))
+	for _, ip := range e.integrated {
+		integrator, ok := energy.Integrated[ip.name]
+		if !ok {
+			integrator = &powerIntegrator{}
+			energy.Integrated[ip.name] = integrator
+		}
+		if newDay {
+			energy.DayStart[ip.name] = integrator.Total
+		}
+		d.IntegratedEnergy[ip.name] = integrator.Total
+		if d.reported(ip.variable) {
+			d.IntegratedEnergy[ip.name] = integrator.observe(ip.power(*d), d.UpdateTime, e.energyMaxGap)
+		}
+		d.TodayEnergy[ip.name] = d.IntegratedEnergy[ip.name] - energy.DayStart[ip.name]
+	}
+}
@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"go.uber.org/zap"
+)
+
+func TestUpdateEnergyMissingVariables(t *testing.T) {
+	reading := func(minutes int, yield, power float64, reported bool) metricData {
+		d := metricData{
+			InverterSN: "sn-1",
+			UpdateTime: testNow.Add(time.Duration(minutes) * time.Minute),
+			Variables:  make(map[foxesscloud.Variable]bool),
+		}
+		if reported {
+			d.setVariable(foxesscloud.VariableTodayYield, yield)
+			d.setVariable(foxesscloud.VariablePvPower, power)
+		}
+		return d
+	}
+	// the variables are missing for more readings than the glitch tolerance
+	readings := []struct {
+		data       metricData
+		generated  float64
+		integrated float64
+	}{
+		{data: reading(0, 5, 2, true)},
+		{data: reading(3, 0, 0, false)},
+		{data: reading(6, 0, 0, false)},
+		{data: reading(9, 0, 0, false)},
+		{data: reading(12, 6, 2, true), generated: 1, integrated: 0.4},
+	}
+
+	exp, err := New(testConfig("sn-1"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("could not create exporter: %v", err)
+	}
+	for i, r := range readings {
+		data := []metricData{r.data}
+		exp.updateEnergy(data)
+		if got := data[0].GeneratedEnergyTotal; !approxEqual(got, r.generated) {
+			t.Errorf("reading %v: expected generated energy %v, got %v", i, r.generated, got)
+		}
+		if got := data[0].IntegratedEnergy["photovoltaic"]; !approxEqual(got, r.integrated) {
+			t.Errorf("reading %v: expected integrated energy %v, got %v", i, r.integrated, got)
+		}
+	}
+}
+
+func TestDailyEnergyCounter(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 6, day, hour, minute, 0, 0, time.FixedZone("CEST", 2*60*60))
+	}
+	type reading struct {
+		value float64
+		ts    time.Time
+		total float64
+	}
+	tests := []struct {
+		name     string
+		readings []reading
+	}{
+		{
+			name:     "increasing",
+			readings: []reading{{5, at(21, 10, 0), 0}, {6, at(21, 10, 5), 1}, {6, at(21, 10, 10), 1}},
+		},
+		{
+			// midnight in the timezone of the readings, 22:05 UTC is still the same day
+			name:     "midnight reset",
+			readings: []reading{{10, at(20, 23, 55), 0}, {0.5, at(21, 0, 5), 0.5}, {1.5, at(21, 0, 10), 1.5}},
+		},
+		{
+			name:     "glitch",
+			readings: []reading{{5, at(21, 10, 0), 0}, {0, at(21, 10, 5), 0}, {5.5, at(21, 10, 10), 0.5}},
+		},
+		{
+			name: "drop accepted after max glitch readings",
+			readings: []reading{
+				{5, at(21, 10, 0), 0}, {1, at(21, 10, 5), 0}, {1, at(21, 10, 10), 0}, {1, at(21, 10, 15), 0}, {2, at(21, 10, 20), 1},
+			},
+		},
+		{
+			name:     "out of order",
+			readings: []reading{{5, at(21, 10, 5), 0}, {4, at(21, 10, 0), 0}, {6, at(21, 10, 10), 1}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var c dailyEnergyCounter
+			for i, r := range test.readings {
+				if got := c.observe(r.value, r.ts); !approxEqual(got, r.total) {
+					t.Errorf("reading %v: expected total %v, got %v", i, r.total, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPowerIntegrator(t *testing.T) {
+	type reading struct {
+		power   float64
+		minutes int
+		total   float64
+	}
+	tests := []struct {
+		name     string
+		readings []reading
+	}{
+		{
+			name:     "constant power",
+			readings: []reading{{2, 0, 0}, {2, 15, 0.5}},
+		},
+		{
+			name:     "trapezoid",
+			readings: []reading{{0, 0, 0}, {4, 15, 0.5}},
+		},
+		{
+			// the interval over the max gap is skipped, the next one is integrated again
+			name:     "gap",
+			readings: []reading{{2, 0, 0}, {2, 20, 0}, {2, 26, 0.2}},
+		},
+		{
+			name:     "negative power",
+			readings: []reading{{-1, 0, 0}, {-1, 10, 0}, {3, 20, 0.25}},
+		},
+		{
+			name:     "duplicate and out of order",
+			readings: []reading{{2, 5, 0}, {4, 5, 0}, {4, 0, 0}, {2, 11, 0.2}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var p powerIntegrator
+			for i, r := range test.readings {
+				ts := testNow.Add(time.Duration(r.minutes) * time.Minute)
+				if got := p.observe(r.power, ts, time.Minute*15); !approxEqual(got, r.total) {
+					t.Errorf("reading %v: expected total %v, got %v", i, r.total, got)
+				}
+			}
+		})
+	}
+}
@@ -5,16 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"maps"
-	"strings"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/jbub/foxesscloud"
 	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/openapi"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/collectors/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -30,62 +36,243 @@ type metric struct {
 	help    string
 	valType prometheus.ValueType
 	eval    func(data metricData) float64
+	// variables are the API variables the metric is computed from
+	variables []foxesscloud.Variable
+	// optionalVariables are requested along with the variables, the metric is available without them
+	optionalVariables []foxesscloud.Variable
+	// scrapeTime metrics are computed at scrape time and never exposed with the reading timestamp
+	scrapeTime bool
+	// labels are added to the inverter labels, e.g. the grid phase
+	labels prometheus.Labels
+	// naming is the naming scheme the metric belongs to, empty for metrics of all schemes
+	naming string
+	// unit is the OpenMetrics unit, the name has to end with it
+	unit string
+	// present reports whether the metric has a value for the data besides its variables being reported,
+	// e.g. a ratio with a zero denominator, nil for metrics present whenever their variables are
+	present func(data metricData) bool
+}
+
+// available reports whether the metric is present and all its variables are reported in the data, so that missing
+// variables are not exposed as zeros.
+func (m metric) available(data metricData) bool {
+	if m.present != nil && !m.present(data) {
+		return false
+	}
+	if data.Variables == nil {
+		return true
+	}
+	for _, variable := range m.variables {
+		if !data.Variables[variable] {
+			return false
+		}
+	}
+	return true
 }
 
 func (m metric) desc(constLabels prometheus.Labels) *prometheus.Desc {
+	if len(m.labels) > 0 {
+		constLabels = maps.Clone(constLabels)
+		maps.Copy(constLabels, m.labels)
+	}
 	return prometheus.NewDesc(prometheus.BuildFQName("foxesscloud", "", m.name), m.help, nil, constLabels)
 }
 
+var faultLabels = []string{"code", "description"}
+
+func faultActiveDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_inverter_fault_active", "Whether the fault is currently active on the inverter.", faultLabels, constLabels)
+}
+
+func restoredDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_data_restored", "Whether the exported data was restored from the state file and not fetched yet.", nil, constLabels)
+}
+
+func apiRequestsDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_api_requests_total", "Total number of requests made to the Fox ESS API.", nil, constLabels)
+}
+
+func apiRequestsTodayDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_api_requests_today", "Number of requests made to the Fox ESS API today.", nil, constLabels)
+}
+
+func variablesReportedDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_variables_reported", "Number of variables reported in the last reading.", nil, constLabels)
+}
+
+func faultLastSeenDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_inverter_fault_last_seen_timestamp_seconds", "Timestamp when the fault was last reported by the inverter in seconds.", faultLabels, constLabels)
+}
+
 type Exporter struct {
-	log         *zap.Logger
-	inverters   []string
-	constLabels prometheus.Labels
-	metrics     []metric
-	client      *foxesscloud.Client
-	data        atomic.Pointer[[]metricData]
-	interval    time.Duration
-	timeout     time.Duration
-	done        chan struct{}
-}
-
-func New(cfg config.Config, log *zap.Logger, client *foxesscloud.Client) (*Exporter, error) {
-	if len(cfg.Inverters) == 0 {
-		return nil, fmt.Errorf("no inverters defined")
-	}
-
-	return &Exporter{
-		log:         log,
-		inverters:   cfg.Inverters,
-		constLabels: parseLabels(cfg.DefaultLabels),
-		metrics:     buildMetrics(),
-		client:      client,
-		interval:    cfg.APIFetchInterval,
-		timeout:     cfg.APIFetchTimeout,
-		done:        make(chan struct{}, 1),
-	}, nil
+	log              *zap.Logger
+	inverters        []string
+	constLabels      prometheus.Labels
+	metrics          []metric
+	accounts         map[string]account
+	data             atomic.Pointer[[]metricData]
+	faultHistory     *faultHistory
+	energyMu         sync.Mutex
+	energy           map[string]*inverterEnergy
+	energyMaxGap     time.Duration
+	integrated       []integratedPower
+	ratios           []flowRatio
+	stateFile        string
+	stateInterval    time.Duration
+	stateDirty       atomic.Bool
+	local            map[string]localSource
+	usage            *apiUsage
+	schedule         *fetchSchedule
+	cadence          *cadenceTracker
+	timestamps       *sampleTimestamps
+	payload          *payloadStats
+	units            *unitNormaliser
+	variables        []foxesscloud.Variable
+	modbusStaleAfter time.Duration
+	tracer           trace.Tracer
+	scrape           *scrapeFetcher
+	probes           *probeCache
+	limiter          *rate.Limiter
+	concurrency      int
+	cycleTimeout     time.Duration
+	batchSize        int
+	timeout          time.Duration
+	done             chan struct{}
+}
+
+func New(cfg config.Config, log *zap.Logger) (*Exporter, error) {
+	st := &state{}
+	if cfg.StateFile != "" {
+		var err error
+		st, err = loadState(cfg.StateFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load state: %w", err)
+		}
+	}
+	energy := st.Energy
+	if energy == nil {
+		energy = make(map[string]*inverterEnergy)
+	}
+
+	switch cfg.MetricNaming {
+	case config.MetricNamingLegacy, config.MetricNamingV2, config.MetricNamingBoth:
+	default:
+		return nil, fmt.Errorf("unsupported metric naming: %v", cfg.MetricNaming)
+	}
+
+	if cfg.EfficiencyThreshold < 0 || cfg.EfficiencyThreshold > 1 {
+		return nil, fmt.Errorf("efficiency threshold must be between 0 and 1: %v", cfg.EfficiencyThreshold)
+	}
+
+	if cfg.SiteLocated {
+		if cfg.SiteLatitude < -90 || cfg.SiteLatitude > 90 {
+			return nil, fmt.Errorf("site latitude must be between -90 and 90: %v", cfg.SiteLatitude)
+		}
+		if cfg.SiteLongitude < -180 || cfg.SiteLongitude > 180 {
+			return nil, fmt.Errorf("site longitude must be between -180 and 180: %v", cfg.SiteLongitude)
+		}
+	}
+
+	metrics := buildMetrics(cfg)
+	variables := requiredVariables(metrics)
+	cadence := newCadenceTracker()
+	exp := &Exporter{
+		log:              log,
+		inverters:        cfg.Inverters,
+		constLabels:      config.ParseLabels(cfg.DefaultLabels),
+		metrics:          metrics,
+		accounts:         make(map[string]account),
+		probes:           newProbeCache(cfg.APIFetchMinAge, max(cfg.APIFetchInterval*probeTTLIntervals, cfg.APIFetchMinAge), maxProbeEntries),
+		limiter:          newRateLimiter(cfg.APIRateLimit),
+		concurrency:      max(cfg.APIFetchConcurrency, 1),
+		cycleTimeout:     cfg.APIFetchCycleTimeout,
+		batchSize:        min(cfg.APIBatchSize, openapi.MaxBatchSize),
+		faultHistory:     newFaultHistory(),
+		energy:           energy,
+		energyMaxGap:     cfg.EnergyMaxGap,
+		integrated:       exposedPowers(metrics),
+		ratios:           flowRatios(),
+		stateFile:        cfg.StateFile,
+		stateInterval:    cfg.StateSaveInterval,
+		local:            newLocalSources(cfg.LocalInverters, cfg.APIFetchTimeout),
+		usage:            newAPIUsage(st.Usage),
+		schedule:         newFetchSchedule(cfg, cadence),
+		cadence:          cadence,
+		timestamps:       newSampleTimestamps(cfg.MetricTimestamps),
+		payload:          newPayloadStats(),
+		units:            newUnitNormaliser(log),
+		variables:        variables,
+		modbusStaleAfter: cfg.ModbusStaleAfter,
+		tracer:           otel.Tracer(Name),
+		timeout:          cfg.APIFetchTimeout,
+		done:             make(chan struct{}, 1),
+	}
+
+	switch cfg.APIFetchMode {
+	case config.FetchModeInterval:
+	case config.FetchModeScrape:
+		exp.scrape = &scrapeFetcher{minAge: cfg.APIFetchMinAge}
+	default:
+		return nil, fmt.Errorf("unsupported fetch mode: %v", cfg.APIFetchMode)
+	}
+
+	if readings := restoredReadings(st.Readings, cfg.Inverters); len(readings) > 0 {
+		exp.data.Store(&readings)
+	}
+	return exp, nil
+}
+
+func restoredReadings(readings []metricData, inverters []string) []metricData {
+	res := make([]metricData, 0, len(readings))
+	for _, d := range readings {
+		if slices.Contains(inverters, d.InverterSN) {
+			res = append(res, d)
+		}
+	}
+	return res
 }
 
 func (e *Exporter) Start() error {
 	ctx := context.Background()
+	go e.runPersist()
+	e.fetchFaultHistory(ctx)
+
+	// scrapes or probes drive the fetches, there is nothing to do until shutdown
+	if e.scrape != nil || len(e.inverters) == 0 {
+		<-e.done
+		e.persistState()
+		return nil
+	}
+
+	now := time.Now()
 	data, err := e.fetchInvertersInitial(ctx)
 	if err != nil {
 		return fmt.Errorf("could not fetch inverter data: %w", err)
 	}
-	e.data.Store(&data)
-
-	tick := time.NewTicker(e.interval)
-	defer tick.Stop()
+	if data != nil {
+		e.storeData(data)
+	}
+	e.schedule.fetched(e.inverters, now)
 
 	for {
+		next := e.schedule.nextFetch()
+		e.log.Debug("scheduled next inverter fetch", zap.Time("next", next))
+
+		timer := time.NewTimer(time.Until(next))
 		select {
-		case <-tick.C:
-			data, err := e.fetchInverters(ctx)
+		case <-timer.C:
+			now := time.Now()
+			due := e.schedule.due(now)
+			data, err := e.fetchInverters(ctx, due)
+			e.schedule.fetched(due, now)
 			if err != nil {
 				e.log.Error("could not fetch inverter data", zap.Error(err))
 				continue
 			}
-			e.data.Store(&data)
+			e.storeData(data)
 		case <-e.done:
+			timer.Stop()
+			e.persistState()
 			return nil
 		}
 	}
@@ -95,47 +282,155 @@ func (e *Exporter) Shutdown() {
 	close(e.done)
 }
 
+func (e *Exporter) storeData(data []metricData) {
+	var prev []metricData
+	if p := e.data.Load(); p != nil {
+		prev = *p
+	}
+	e.logFaultTransitions(prev, data)
+	e.logSourceTransitions(prev, data)
+	e.updateEnergy(data)
+	for _, d := range data {
+		e.faultHistory.record(d.InverterSN, d.Faults, d.UpdateTime)
+	}
+	e.data.Store(&data)
+	e.stateDirty.Store(true)
+}
+
+func (e *Exporter) previousFaults(inverterSN string) []fault {
+	d, _ := e.latestData(inverterSN)
+	return d.Faults
+}
+
+func (e *Exporter) latestData(inverterSN string) (metricData, bool) {
+	data := e.data.Load()
+	if data == nil {
+		return metricData{}, false
+	}
+	for _, d := range *data {
+		if d.InverterSN == inverterSN {
+			return d, true
+		}
+	}
+	return metricData{}, false
+}
+
 func (e *Exporter) Describe(descs chan<- *prometheus.Desc) {
+	sources := []string{sourceCloud}
+	if len(e.local) > 0 {
+		sources = append(sources, sourceLocal)
+	}
+
 	for _, inverterSN := range e.inverters {
-		labels := e.buildLabels(inverterSN)
-		for _, m := range e.metrics {
-			descs <- m.desc(labels)
+		for _, source := range sources {
+			labels := e.buildLabels(inverterSN, source)
+			for _, m := range e.metrics {
+				descs <- m.desc(labels)
+			}
+			descs <- faultActiveDesc(labels)
+			descs <- faultLastSeenDesc(labels)
+			descs <- restoredDesc(labels)
+			descs <- variablesReportedDesc(labels)
+			e.describeRatios(descs, labels)
 		}
 	}
+	e.describeSiteRatios(descs)
+	for _, inverterSN := range e.inverters {
+		descs <- apiRequestedVariablesDesc(e.buildLabels(inverterSN, sourceCloud))
+		descs <- apiUnsupportedVariablesDesc(e.buildLabels(inverterSN, sourceCloud))
+		descs <- duplicateReadingsDesc(e.buildLabels(inverterSN, sourceCloud))
+	}
+	descs <- apiRequestsDesc(e.constLabels)
+	descs <- apiRequestsTodayDesc(e.constLabels)
+	descs <- apiResponseSizeDesc(e.constLabels)
 }
 
 func (e *Exporter) Collect(metrics chan<- prometheus.Metric) {
+	usage := e.usage.get(time.Now())
+	metrics <- prometheus.MustNewConstMetric(apiRequestsDesc(e.constLabels), prometheus.CounterValue, usage.Total)
+	metrics <- prometheus.MustNewConstMetric(apiRequestsTodayDesc(e.constLabels), prometheus.GaugeValue, usage.Today)
+	e.collectPayload(metrics)
+	e.collectCadence(metrics)
+
 	data := e.data.Load()
 	if data == nil {
 		return
 	}
+	e.collectData(metrics, *data)
+	e.collectSiteRatios(metrics, *data)
+}
+
+func (e *Exporter) collectData(metrics chan<- prometheus.Metric, data []metricData) {
+	now := time.Now()
+	timestamps := make([]time.Time, len(data))
+	exposed := make([]bool, len(data))
+	for i, d := range data {
+		timestamps[i], exposed[i] = e.timestamps.get(d.InverterSN, d.UpdateTime, now)
+	}
 
 	for _, m := range e.metrics {
-		for _, d := range *data {
-			metrics <- prometheus.MustNewConstMetric(
-				m.desc(e.buildLabels(d.InverterSN)),
+		for i, d := range data {
+			if (!exposed[i] && !m.scrapeTime) || !m.available(d) {
+				continue
+			}
+			metric := prometheus.MustNewConstMetric(
+				m.desc(e.buildLabels(d.InverterSN, d.Source)),
 				m.valType,
 				m.eval(d),
 			)
+			if !m.scrapeTime {
+				metric = withTimestamp(metric, timestamps[i])
+			}
+			metrics <- metric
+		}
+	}
+
+	e.collectRatios(metrics, data, exposed, timestamps)
+
+	for i, d := range data {
+		labels := e.buildLabels(d.InverterSN, d.Source)
+		if exposed[i] {
+			metrics <- withTimestamp(prometheus.MustNewConstMetric(restoredDesc(labels), prometheus.GaugeValue, boolToFloat(d.Restored)), timestamps[i])
+			metrics <- withTimestamp(prometheus.MustNewConstMetric(variablesReportedDesc(labels), prometheus.GaugeValue, float64(len(d.Variables))), timestamps[i])
+			for _, f := range d.Faults {
+				metrics <- withTimestamp(prometheus.MustNewConstMetric(faultActiveDesc(labels), prometheus.GaugeValue, 1, f.Code, f.Description), timestamps[i])
+			}
+		}
+		for f, ts := range e.faultHistory.get(d.InverterSN) {
+			metrics <- prometheus.MustNewConstMetric(faultLastSeenDesc(labels), prometheus.GaugeValue, float64(ts.Unix()), f.Code, f.Description)
 		}
 	}
 }
 
 const (
 	inverterSNLabel = "inverter_sn"
+	sourceLabel     = "source"
+	phaseLabel      = "phase"
+	stringLabel     = "string"
 )
 
-func (e *Exporter) buildLabels(inverterSN string) prometheus.Labels {
-	if len(e.constLabels) == 0 {
-		return prometheus.Labels{inverterSNLabel: inverterSN}
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (e *Exporter) buildLabels(inverterSN string, source string) prometheus.Labels {
+	labels := prometheus.Labels{inverterSNLabel: inverterSN}
+	if len(e.constLabels) > 0 {
+		labels = maps.Clone(e.constLabels)
+		labels[inverterSNLabel] = inverterSN
+	}
+	// the source label is only added when the local fallback is configured, so that the series stay the same otherwise
+	if len(e.local) > 0 {
+		labels[sourceLabel] = source
 	}
-	labels := maps.Clone(e.constLabels)
-	labels[inverterSNLabel] = inverterSN
 	return labels
 }
 
 func (e *Exporter) fetchInvertersInitial(ctx context.Context) ([]metricData, error) {
-	data, err := e.fetchInverters(ctx)
+	data, err := e.fetchInverters(ctx, e.inverters)
 	if err != nil {
 		// in case initial fetch fails on context error (timeout, cancel), we want the program to continue
 		// the next tick will retry the fetch instead of exiting the program
@@ -146,8 +441,7 @@ func (e *Exporter) fetchInvertersInitial(ctx context.Context) ([]metricData, err
 
 		// in case initial fetch fails on rate limit, we want the program to continue
 		// the next tick will retry the fetch instead of exiting the program
-		var errRate *foxesscloud.RateLimitExceededError
-		if errors.As(err, &errRate) {
+		if isRateLimitError(err) {
 			e.log.Error("initial inverter fetch rate limit exceeded", zap.Error(err))
 			return data, nil
 		}
@@ -156,135 +450,274 @@ func (e *Exporter) fetchInvertersInitial(ctx context.Context) ([]metricData, err
 	return data, nil
 }
 
-func (e *Exporter) fetchInverters(ctx context.Context) ([]metricData, error) {
-	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+func isRateLimitError(err error) bool {
+	var errRate *foxesscloud.RateLimitExceededError
+	var errAPIRate *openapi.RateLimitExceededError
+	return errors.As(err, &errRate) || errors.As(err, &errAPIRate)
+}
+
+// fetchInverters fetches the inverters concurrently by a bounded number of workers within the cycle timeout.
+// Results keep the order of all inverters, inverters which were not fetched or could not be fetched keep their
+// previous data and an error is returned only when all of the fetched inverters failed.
+func (e *Exporter) fetchInverters(ctx context.Context, inverters []string) ([]metricData, error) {
+	ctx, span := e.tracer.Start(ctx, "fetch inverters", trace.WithAttributes(attribute.Int("inverters", len(inverters))))
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, e.cycleTimeout)
 	defer cancel()
 
-	res := make([]metricData, 0, len(e.inverters))
+	fetchedAt := time.Now()
+	acc := e.accounts[config.DefaultAccount]
+	res := make([]metricData, len(inverters))
+	errs := make([]error, len(inverters))
+
+	// every job fetches a batch of inverters starting at the given index
+	size := max(e.batchSize, 1)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(e.concurrency, (len(inverters)+size-1)/size) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range jobs {
+				end := min(start+size, len(inverters))
+				if e.batchSize > 1 {
+					batchRes, batchErrs := e.fetchInverterBatch(ctx, acc, inverters[start:end])
+					copy(res[start:end], batchRes)
+					copy(errs[start:end], batchErrs)
+					continue
+				}
+				res[start], errs[start] = e.fetchInverter(ctx, acc, inverters[start])
+			}
+		}()
+	}
+	for start := 0; start < len(inverters); start += size {
+		jobs <- start
+	}
+	close(jobs)
+	wg.Wait()
+
+	var failed []error
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Errorf("inverter %v: %w", inverters[i], err))
+		}
+	}
+	if len(failed) > 0 && len(failed) == len(inverters) {
+		err := errors.Join(failed...)
+		recordError(span, err)
+		return nil, err
+	}
+
+	fetched := make(map[string]metricData, len(inverters))
+	for i, inverterSN := range inverters {
+		if errs[i] != nil {
+			e.logger(ctx).Error("could not fetch inverter data", zap.String("inverter_sn", inverterSN), zap.Error(errs[i]))
+			continue
+		}
+		fetched[inverterSN] = res[i]
+	}
+	e.observeReadings(fetched, fetchedAt)
+
+	data := make([]metricData, 0, len(e.inverters))
 	for _, inverterSN := range e.inverters {
-		data, err := e.fetchInverterData(ctx, inverterSN)
+		if d, ok := fetched[inverterSN]; ok {
+			data = append(data, d)
+			continue
+		}
+		if d, ok := e.latestData(inverterSN); ok {
+			data = append(data, d)
+		}
+	}
+	return data, nil
+}
+
+// fetchInverter fetches the inverter data from the cloud, falling back to the local source when configured.
+// The inverter timeout starts once the rate limit allows the request, the local fetch has its own timeout.
+func (e *Exporter) fetchInverter(ctx context.Context, acc account, inverterSN string) (metricData, error) {
+	ctx, span := e.tracer.Start(ctx, "fetch inverter", trace.WithAttributes(attribute.String(inverterSNLabel, inverterSN)))
+	defer span.End()
+
+	if err := e.limiter.Wait(ctx); err != nil {
+		err = fmt.Errorf("could not wait for rate limit: %w", err)
+		recordError(span, err)
+		return metricData{}, err
+	}
+
+	cloudCtx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	data, err := e.fetchInverterData(cloudCtx, acc, inverterSN)
+	if err != nil {
+		data, err = e.fetchLocalFallback(ctx, inverterSN, err)
 		if err != nil {
-			return nil, err
+			recordError(span, err)
+			return metricData{}, err
 		}
-		res = append(res, data)
 	}
-	return res, nil
+	span.SetAttributes(attribute.String(sourceLabel, data.Source))
+	return data, nil
+}
+
+// fetchLocalFallback fetches the inverter data from the local source after the cloud fetch failed,
+// the cloud error is returned when there is no local source configured.
+func (e *Exporter) fetchLocalFallback(ctx context.Context, inverterSN string, cloudErr error) (metricData, error) {
+	local, ok := e.local[inverterSN]
+	if !ok {
+		return metricData{}, cloudErr
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("cloud fetch failed", trace.WithAttributes(
+		attribute.String(inverterSNLabel, inverterSN),
+		attribute.String("error", cloudErr.Error()),
+	))
+	e.logger(ctx).Debug("could not fetch inverter data from cloud, using local source", zap.String("inverter_sn", inverterSN), zap.Error(cloudErr))
+
+	data, err := e.fetchLocalData(ctx, inverterSN, local)
+	if err != nil {
+		return metricData{}, fmt.Errorf("could not fetch inverter data from cloud nor local source: %w", err)
+	}
+	return data, nil
+}
+
+// waitRequest blocks until the rate limit allows another API request and records the request in the usage.
+func (e *Exporter) waitRequest(ctx context.Context) error {
+	if err := e.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("could not wait for rate limit: %w", err)
+	}
+	e.usage.record(time.Now())
+	return nil
 }
 
-func (e *Exporter) fetchInverterData(ctx context.Context, inverterSN string) (metricData, error) {
-	e.log.Debug("fetching inverter data", zap.String("inverter_sn", inverterSN))
+func (e *Exporter) fetchInverterData(ctx context.Context, acc account, inverterSN string) (metricData, error) {
+	e.logger(ctx).Debug("fetching inverter data", zap.String("inverter_sn", inverterSN))
 
-	data, err := e.client.Inverters.GetRealtimeData(ctx, foxesscloud.GetInverterRealtimeDataOptions{
-		InverterSN: inverterSN,
-	})
+	variables := e.requestVariables(inverterSN)
+	e.usage.record(time.Now())
+	// fault codes are requested along so they do not need a separate request
+	request := append(slices.Clip(variables), foxesscloud.VariableCurrentFault)
+	e.payload.addRequest([]string{inverterSN}, request)
+	data, err := acc.api.GetRealtimeData(ctx, inverterSN, request)
 	if err != nil {
 		return metricData{}, err
 	}
 
-	e.log.Debug("fetched inverter data", zap.String("inverter_sn", inverterSN), zap.Int("num_items", len(data.Items)))
+	e.logger(ctx).Debug("fetched inverter data", zap.String("inverter_sn", inverterSN), zap.Int("num_items", len(data)))
 
-	if len(data.Items) == 0 {
+	if len(data) == 0 {
 		return metricData{}, fmt.Errorf("no data")
 	}
-	item := data.Items[0]
-
-	d := metricData{
-		InverterSN: inverterSN,
-		UpdateTime: item.Time.Time,
-	}
-
-	for _, dataItem := range item.Datas {
-		switch dataItem.Variable {
-		case foxesscloud.VariableGeneration:
-			d.TotalGeneratedPower = dataItem.Value.Value
-		case foxesscloud.VariableTodayYield:
-			d.TodayGeneratedPower = dataItem.Value.Value
-		case foxesscloud.VariableFeedinPower:
-			d.FeedInPower = dataItem.Value.Value
-		case foxesscloud.VariablePvPower:
-			d.PhotovoltaicPower = dataItem.Value.Value
-		case foxesscloud.VariableLoadsPower:
-			d.LoadPower = dataItem.Value.Value
-		case foxesscloud.VariableGenerationPower:
-			d.OutputPower = dataItem.Value.Value
-		case foxesscloud.VariableGridConsumptionPower:
-			d.GridConsumptionPower = dataItem.Value.Value
-		case foxesscloud.VariableAmbientTemperation:
-			d.AmbientTemperature = dataItem.Value.Value
-		case foxesscloud.VariableBoostTemperation:
-			d.BoostTemperature = dataItem.Value.Value
-		case foxesscloud.VariableInvTemperation:
-			d.InverterTemperature = dataItem.Value.Value
-		case foxesscloud.VariablePv1Volt:
-			d.PV1Voltage = dataItem.Value.Value
-		case foxesscloud.VariablePv1Current:
-			d.PV1Current = dataItem.Value.Value
-		case foxesscloud.VariablePv1Power:
-			d.PV1Power = dataItem.Value.Value
-		case foxesscloud.VariablePv2Volt:
-			d.PV2Voltage = dataItem.Value.Value
-		case foxesscloud.VariablePv2Current:
-			d.PV2Current = dataItem.Value.Value
-		case foxesscloud.VariablePv2Power:
-			d.PV2Power = dataItem.Value.Value
-		case foxesscloud.VariablePv3Volt:
-			d.PV3Voltage = dataItem.Value.Value
-		case foxesscloud.VariablePv3Current:
-			d.PV3Current = dataItem.Value.Value
-		case foxesscloud.VariablePv3Power:
-			d.PV3Power = dataItem.Value.Value
-		case foxesscloud.VariablePv4Volt:
-			d.PV4Voltage = dataItem.Value.Value
-		case foxesscloud.VariablePv4Current:
-			d.PV4Current = dataItem.Value.Value
-		case foxesscloud.VariablePv4Power:
-			d.PV4Power = dataItem.Value.Value
-		case foxesscloud.VariableRPower:
-			d.ReferencePower = dataItem.Value.Value
-		case foxesscloud.VariableRVolt:
-			d.ReferenceVoltage = dataItem.Value.Value
-		case foxesscloud.VariableRCurrent:
-			d.ReferenceCurrent = dataItem.Value.Value
-		case foxesscloud.VariableRFreq:
-			d.ReferenceFrequency = dataItem.Value.Value
-		case foxesscloud.VariableSPower:
-			d.SecondaryPower = dataItem.Value.Value
-		case foxesscloud.VariableSVolt:
-			d.SecondaryVoltage = dataItem.Value.Value
-		case foxesscloud.VariableSCurrent:
-			d.SecondaryCurrent = dataItem.Value.Value
-		case foxesscloud.VariableSFreq:
-			d.SecondaryFrequency = dataItem.Value.Value
-		case foxesscloud.VariableTPower:
-			d.TertiaryPower = dataItem.Value.Value
-		case foxesscloud.VariableTVolt:
-			d.TertiaryVoltage = dataItem.Value.Value
-		case foxesscloud.VariableTCurrent:
-			d.TertiaryCurrent = dataItem.Value.Value
-		case foxesscloud.VariableTFreq:
-			d.TertiaryFrequency = dataItem.Value.Value
-		case foxesscloud.VariableRunningState:
-			d.RunningState = dataItem.Value.Value
-		case foxesscloud.VariableCurrentFaultCount:
-			d.FaultCount = dataItem.Value.Value
-		}
+
+	reported := make([]foxesscloud.Variable, 0, len(data[0].Datas))
+	for _, dataItem := range data[0].Datas {
+		reported = append(reported, dataItem.Variable)
+	}
+	e.checkVariables(ctx, inverterSN, variables, reported)
+
+	d := newMetricDataFromAPI(inverterSN, data[0], e.units)
+	if d.FaultCount > 0 && !hasVariable(data[0], foxesscloud.VariableCurrentFault) {
+		d.Faults = e.previousFaults(inverterSN)
 	}
 	return d, nil
 }
 
-func parseLabels(s string) prometheus.Labels {
-	if s == "" {
-		return nil
+// reported reports whether the variable is present in the data, restored data has no variables and reports all of them.
+func (d metricData) reported(variable foxesscloud.Variable) bool {
+	return d.Variables == nil || d.Variables[variable]
+}
+
+func (d *metricData) setVariable(variable foxesscloud.Variable, value float64) {
+	if d.Variables == nil {
+		d.Variables = make(map[foxesscloud.Variable]bool)
 	}
+	d.Variables[variable] = true
 
-	items := strings.Split(s, " ")
-	res := make(prometheus.Labels, len(items))
-	for _, item := range items {
-		if item == "" {
-			continue
-		}
-		if parts := strings.SplitN(item, "=", 2); len(parts) == 2 {
-			res[parts[0]] = parts[1]
+	if n, quantity, ok := parsePVStringVariable(variable); ok {
+		d.setPVString(n, quantity, value)
+	}
+
+	switch variable {
+	case foxesscloud.VariableGeneration:
+		d.TotalGeneratedPower = value
+	case foxesscloud.VariableTodayYield:
+		d.TodayGeneratedPower = value
+	case foxesscloud.VariableFeedinPower:
+		d.FeedInPower = value
+	case foxesscloud.VariablePvPower:
+		d.PhotovoltaicPower = value
+	case foxesscloud.VariableLoadsPower:
+		d.LoadPower = value
+	case foxesscloud.VariableGenerationPower:
+		d.OutputPower = value
+	case foxesscloud.VariableGridConsumptionPower:
+		d.GridConsumptionPower = value
+	case foxesscloud.VariableAmbientTemperation:
+		d.AmbientTemperature = value
+	case foxesscloud.VariableBoostTemperation:
+		d.BoostTemperature = value
+	case foxesscloud.VariableInvTemperation:
+		d.InverterTemperature = value
+	case foxesscloud.VariablePv1Volt:
+		d.PV1Voltage = value
+	case foxesscloud.VariablePv1Current:
+		d.PV1Current = value
+	case foxesscloud.VariablePv1Power:
+		d.PV1Power = value
+	case foxesscloud.VariablePv2Volt:
+		d.PV2Voltage = value
+	case foxesscloud.VariablePv2Current:
+		d.PV2Current = value
+	case foxesscloud.VariablePv2Power:
+		d.PV2Power = value
+	case foxesscloud.VariablePv3Volt:
+		d.PV3Voltage = value
+	case foxesscloud.VariablePv3Current:
+		d.PV3Current = value
+	case foxesscloud.VariablePv3Power:
+		d.PV3Power = value
+	case foxesscloud.VariablePv4Volt:
+		d.PV4Voltage = value
+	case foxesscloud.VariablePv4Current:
+		d.PV4Current = value
+	case foxesscloud.VariablePv4Power:
+		d.PV4Power = value
+	case foxesscloud.VariableRPower:
+		d.ReferencePower = value
+	case foxesscloud.VariableRVolt:
+		d.ReferenceVoltage = value
+	case foxesscloud.VariableRCurrent:
+		d.ReferenceCurrent = value
+	case foxesscloud.VariableRFreq:
+		d.ReferenceFrequency = value
+	case foxesscloud.VariableSPower:
+		d.SecondaryPower = value
+	case foxesscloud.VariableSVolt:
+		d.SecondaryVoltage = value
+	case foxesscloud.VariableSCurrent:
+		d.SecondaryCurrent = value
+	case foxesscloud.VariableSFreq:
+		d.SecondaryFrequency = value
+	case foxesscloud.VariableTPower:
+		d.TertiaryPower = value
+	case foxesscloud.VariableTVolt:
+		d.TertiaryVoltage = value
+	case foxesscloud.VariableTCurrent:
+		d.TertiaryCurrent = value
+	case foxesscloud.VariableTFreq:
+		d.TertiaryFrequency = value
+	case foxesscloud.VariableRunningState:
+		d.RunningState = value
+	case foxesscloud.VariableCurrentFaultCount:
+		d.FaultCount = value
+	}
+}
+
+// Units returns the OpenMetrics units of the exported metrics by their name.
+func (e *Exporter) Units() map[string]string {
+	res := make(map[string]string)
+	for _, m := range e.metrics {
+		if m.unit != "" {
+			res[prometheus.BuildFQName("foxesscloud", "", m.name)] = m.unit
 		}
 	}
 	return res
@@ -301,3 +734,11 @@ func NewRegistry(exp *Exporter) prometheus.Gatherer {
 	reg.MustRegister(exp)
 	return reg
 }
+
+// newRateLimiter returns a limiter allowing the given number of requests per second, non positive values disable the limit.
+func newRateLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), 1)
+}
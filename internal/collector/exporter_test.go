@@ -0,0 +1,415 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/fakeapi"
+	"github.com/jbub/foxesscloud_exporter/internal/openapi"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const testToken = "test-token"
+
+var testNow = time.Date(2024, 6, 21, 12, 7, 0, 0, time.UTC)
+
+func testConfig(inverters ...string) config.Config {
+	return config.Config{
+		Inverters:            inverters,
+		APIFetchMode:         config.FetchModeInterval,
+		APIFetchInterval:     time.Minute,
+		APIFetchTimeout:      time.Second * 5,
+		APIFetchCycleTimeout: time.Second * 10,
+		APIFetchConcurrency:  1,
+		APIBatchSize:         openapi.MaxBatchSize,
+		EnergyMaxGap:         time.Minute * 15,
+		MetricNaming:         config.MetricNamingBoth,
+		EfficiencyThreshold:  0.9,
+	}
+}
+
+func newTestAPI(t *testing.T, cfg fakeapi.Config) (*fakeapi.Server, *httptest.Server) {
+	t.Helper()
+	if cfg.Now == nil {
+		cfg.Now = func() time.Time { return testNow }
+	}
+	if cfg.PeakPower == 0 {
+		cfg.PeakPower = 5
+	}
+	if cfg.Strings == 0 {
+		cfg.Strings = 2
+	}
+	api := fakeapi.New(cfg)
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	return api, srv
+}
+
+func newTestExporter(t *testing.T, cfg config.Config, apiURL string, token string, transport http.RoundTripper) *Exporter {
+	t.Helper()
+	exp, err := New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("could not create exporter: %v", err)
+	}
+	exp.AddAccount(config.DefaultAccount, openapi.NewClient(openapi.Config{
+		Client:  &http.Client{Transport: transport},
+		BaseURL: apiURL,
+		Token:   token,
+	}))
+	return exp
+}
+
+// fetchPaths are the realtime API paths, the v0 path fetches every inverter separately.
+var fetchPaths = []struct {
+	name      string
+	batchSize int
+}{
+	{name: "v0", batchSize: 1},
+	{name: "v1", batchSize: openapi.MaxBatchSize},
+}
+
+func TestFetchInverters(t *testing.T) {
+	for _, path := range fetchPaths {
+		t.Run(path.name, func(t *testing.T) {
+			api, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1", "sn-2"}})
+			cfg := testConfig("sn-1", "sn-2")
+			cfg.APIBatchSize = path.batchSize
+			exp := newTestExporter(t, cfg, srv.URL, testToken, nil)
+
+			data, err := exp.fetchInverters(context.Background(), exp.inverters)
+			if err != nil {
+				t.Fatalf("could not fetch inverters: %v", err)
+			}
+			if len(data) != 2 {
+				t.Fatalf("expected 2 readings, got %v", len(data))
+			}
+
+			for _, d := range data {
+				readings := api.Readings(d.InverterSN, testNow)
+				if d.Source != sourceCloud {
+					t.Errorf("%v: expected source %v, got %v", d.InverterSN, sourceCloud, d.Source)
+				}
+				if want := testNow.Truncate(time.Minute * 5); !d.UpdateTime.Equal(want) {
+					t.Errorf("%v: expected update time %v, got %v", d.InverterSN, want, d.UpdateTime)
+				}
+				if want := readings[foxesscloud.VariablePvPower]; d.PhotovoltaicPower != want {
+					t.Errorf("%v: expected photovoltaic power %v, got %v", d.InverterSN, want, d.PhotovoltaicPower)
+				}
+				if want := readings[foxesscloud.VariableLoadsPower]; d.LoadPower != want {
+					t.Errorf("%v: expected load power %v, got %v", d.InverterSN, want, d.LoadPower)
+				}
+				if len(d.PVStrings) != 2 {
+					t.Errorf("%v: expected 2 PV strings, got %v", d.InverterSN, len(d.PVStrings))
+				}
+				if len(d.Faults) != 0 {
+					t.Errorf("%v: expected no faults, got %v", d.InverterSN, d.Faults)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchInvertersAnyToken(t *testing.T) {
+	_, srv := newTestAPI(t, fakeapi.Config{Inverters: []string{"sn-1"}})
+	exp := newTestExporter(t, testConfig("sn-1"), srv.URL, "any-token", nil)
+
+	if _, err := exp.fetchInverters(context.Background(), exp.inverters); err != nil {
+		t.Fatalf("could not fetch inverters: %v", err)
+	}
+}
+
+func TestFetchInvertersRejectedSignature(t *testing.T) {
+	for _, path := range fetchPaths {
+		t.Run(path.name, func(t *testing.T) {
+			_, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}})
+			cfg := testConfig("sn-1")
+			cfg.APIBatchSize = path.batchSize
+			tamper := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				req = req.Clone(req.Context())
+				req.Header.Set("signature", "invalid")
+				return http.DefaultTransport.RoundTrip(req)
+			})
+			exp := newTestExporter(t, cfg, srv.URL, testToken, tamper)
+
+			_, err := exp.fetchInverters(context.Background(), exp.inverters)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), "illegal signature") {
+				t.Errorf("expected illegal signature error, got %v", err)
+			}
+			if isRateLimitError(err) {
+				t.Errorf("expected signature error not to be a rate limit error")
+			}
+		})
+	}
+}
+
+func TestFetchInvertersWrongToken(t *testing.T) {
+	_, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}})
+	exp := newTestExporter(t, testConfig("sn-1"), srv.URL, "wrong-token", nil)
+
+	_, err := exp.fetchInverters(context.Background(), exp.inverters)
+	if err == nil || !strings.Contains(err.Error(), "invalid token") {
+		t.Fatalf("expected invalid token error, got %v", err)
+	}
+}
+
+func TestFetchInvertersRateLimit(t *testing.T) {
+	for _, path := range fetchPaths {
+		t.Run(path.name, func(t *testing.T) {
+			_, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}, RateLimitProbability: 1})
+			cfg := testConfig("sn-1")
+			cfg.APIBatchSize = path.batchSize
+			exp := newTestExporter(t, cfg, srv.URL, testToken, nil)
+
+			_, err := exp.fetchInverters(context.Background(), exp.inverters)
+			if !isRateLimitError(err) {
+				t.Fatalf("expected rate limit error, got %v", err)
+			}
+
+			// the initial fetch keeps the exporter running on rate limit errors
+			if _, err := exp.fetchInvertersInitial(context.Background()); err != nil {
+				t.Errorf("expected initial fetch to ignore rate limit error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFetchInvertersFaults(t *testing.T) {
+	for _, path := range fetchPaths {
+		t.Run(path.name, func(t *testing.T) {
+			api, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}, FaultProbability: 1})
+			cfg := testConfig("sn-1")
+			cfg.APIBatchSize = path.batchSize
+			var requests int
+			count := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				requests++
+				return http.DefaultTransport.RoundTrip(req)
+			})
+			exp := newTestExporter(t, cfg, srv.URL, testToken, count)
+
+			data, err := exp.fetchInverters(context.Background(), exp.inverters)
+			if err != nil {
+				t.Fatalf("could not fetch inverters: %v", err)
+			}
+			if requests != 1 {
+				t.Errorf("expected faults to be fetched in a single request, got %v requests", requests)
+			}
+
+			code := api.Readings("sn-1", testNow)[foxesscloud.VariableCurrentFault]
+			d := data[0]
+			if d.FaultCount != 1 {
+				t.Errorf("expected fault count 1, got %v", d.FaultCount)
+			}
+			if len(d.Faults) != 1 || d.Faults[0].Code != formatCode(code) {
+				t.Fatalf("expected fault %v, got %v", code, d.Faults)
+			}
+
+			exp.storeData(data)
+			labels := map[string]string{inverterSNLabel: "sn-1", "code": formatCode(code), "description": faultDescriptions[int(code)]}
+			if v, ok := gatherValue(t, NewRegistry(exp), "foxesscloud_inverter_fault_active", labels); !ok || v != 1 {
+				t.Errorf("expected active fault metric, got %v (found %v)", v, ok)
+			}
+		})
+	}
+}
+
+func TestCollectMetrics(t *testing.T) {
+	api, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}})
+	exp := newTestExporter(t, testConfig("sn-1"), srv.URL, testToken, nil)
+
+	data, err := exp.fetchInverters(context.Background(), exp.inverters)
+	if err != nil {
+		t.Fatalf("could not fetch inverters: %v", err)
+	}
+	exp.storeData(data)
+
+	readings := api.Readings("sn-1", testNow)
+	reg := NewRegistry(exp)
+	inverter := map[string]string{inverterSNLabel: "sn-1"}
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{name: "foxesscloud_load_power_kw", labels: inverter, want: readings[foxesscloud.VariableLoadsPower]},
+		{name: "foxesscloud_load_power_watts", labels: inverter, want: readings[foxesscloud.VariableLoadsPower] * 1000},
+		{name: "foxesscloud_feed_in_power_kw", labels: inverter, want: readings[foxesscloud.VariableFeedinPower]},
+		{name: "foxesscloud_generated_power_total_kwh", labels: inverter, want: readings[foxesscloud.VariableGeneration]},
+		{name: "foxesscloud_inverter_temperature_celsius", labels: inverter, want: readings[foxesscloud.VariableInvTemperation]},
+		{name: "foxesscloud_grid_voltage_volts", labels: map[string]string{inverterSNLabel: "sn-1", phaseLabel: "L1"}, want: readings[foxesscloud.VariableRVolt]},
+		{name: "foxesscloud_pv_string_power_watts", labels: map[string]string{inverterSNLabel: "sn-1", stringLabel: "2"}, want: readings[foxesscloud.VariablePv2Power] * 1000},
+		{name: "foxesscloud_fault_count", labels: inverter, want: 0},
+		{name: "foxesscloud_data_restored", labels: inverter, want: 0},
+	}
+	for _, test := range tests {
+		v, ok := gatherValue(t, reg, test.name, test.labels)
+		if !ok {
+			t.Errorf("%v: metric not found", test.name)
+			continue
+		}
+		if !approxEqual(v, test.want) {
+			t.Errorf("%v: expected %v, got %v", test.name, test.want, v)
+		}
+	}
+
+	// the simulated inverter has only two strings, the others are not exposed
+	if _, ok := gatherValue(t, reg, "foxesscloud_pv_string_power_watts", map[string]string{inverterSNLabel: "sn-1", stringLabel: "3"}); ok {
+		t.Error("expected string 3 not to be exposed")
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// gatherValue returns the value of the gathered metric with exactly the given labels.
+func gatherValue(t *testing.T, reg prometheus.Gatherer, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("could not gather metrics: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if len(m.GetLabel()) != len(labels) {
+				continue
+			}
+			match := true
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] != l.GetValue() {
+					match = false
+				}
+			}
+			if !match {
+				continue
+			}
+			switch {
+			case m.GetGauge() != nil:
+				return m.GetGauge().GetValue(), true
+			case m.GetCounter() != nil:
+				return m.GetCounter().GetValue(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func approxEqual(a, b float64) bool {
+	diff := a - b
+	return diff < 1e-9 && diff > -1e-9
+}
+
+func formatCode(code float64) string {
+	return strconv.FormatFloat(code, 'f', -1, 64)
+}
+
+func TestPVStringEnergy(t *testing.T) {
+	tests := []struct {
+		naming  string
+		strings int
+		metrics map[string]map[string]string
+		absent  map[string]map[string]string
+	}{
+		{
+			naming:  config.MetricNamingLegacy,
+			strings: 6,
+			metrics: map[string]map[string]string{"foxesscloud_pv4_energy_kwh_total": {inverterSNLabel: "sn-1"}},
+			absent:  map[string]map[string]string{"foxesscloud_pv_string_energy_joules_total": {inverterSNLabel: "sn-1", stringLabel: "5"}},
+		},
+		{
+			naming:  config.MetricNamingV2,
+			strings: 6,
+			metrics: map[string]map[string]string{"foxesscloud_pv_string_energy_joules_total": {inverterSNLabel: "sn-1", stringLabel: "6"}},
+			absent:  map[string]map[string]string{"foxesscloud_pv4_energy_joules_total": {inverterSNLabel: "sn-1"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.naming, func(t *testing.T) {
+			_, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}, Strings: test.strings})
+			cfg := testConfig("sn-1")
+			cfg.MetricNaming = test.naming
+			exp := newTestExporter(t, cfg, srv.URL, testToken, nil)
+
+			// legacy naming integrates only the first strings
+			wantIntegrated := legacyPVStrings
+			if test.naming == config.MetricNamingV2 {
+				wantIntegrated = maxPVStrings
+			}
+			var integrated int
+			for _, ip := range exp.integrated {
+				if ip.pvString > 0 {
+					integrated++
+				}
+			}
+			if integrated != wantIntegrated {
+				t.Errorf("expected %v integrated strings, got %v", wantIntegrated, integrated)
+			}
+
+			data, err := exp.fetchInverters(context.Background(), exp.inverters)
+			if err != nil {
+				t.Fatalf("could not fetch inverters: %v", err)
+			}
+			exp.storeData(data)
+
+			reg := NewRegistry(exp)
+			for name, labels := range test.metrics {
+				if _, ok := gatherValue(t, reg, name, labels); !ok {
+					t.Errorf("%v: metric not found", name)
+				}
+			}
+			for name, labels := range test.absent {
+				if _, ok := gatherValue(t, reg, name, labels); ok {
+					t.Errorf("%v: expected metric not to be exposed", name)
+				}
+			}
+		})
+	}
+}
+
+func TestUnits(t *testing.T) {
+	tests := []struct {
+		naming string
+		want   map[string]string
+	}{
+		{naming: config.MetricNamingLegacy, want: map[string]string{"foxesscloud_inverter_efficiency_ratio": unitRatio}},
+		{naming: config.MetricNamingV2, want: map[string]string{"foxesscloud_feed_in_energy_joules_total": unitJoules, "foxesscloud_pv_string_power_watts": unitWatts}},
+	}
+	for _, test := range tests {
+		t.Run(test.naming, func(t *testing.T) {
+			cfg := testConfig("sn-1")
+			cfg.MetricNaming = test.naming
+			exp, err := New(cfg, zap.NewNop())
+			if err != nil {
+				t.Fatalf("could not create exporter: %v", err)
+			}
+
+			units := exp.Units()
+			for name, unit := range test.want {
+				if units[name] != unit {
+					t.Errorf("%v: expected unit %q, got %q", name, unit, units[name])
+				}
+			}
+			// OpenMetrics requires the unit to be the suffix of the metric family name
+			for name, unit := range units {
+				if !strings.HasSuffix(strings.TrimSuffix(name, "_total"), "_"+unit) {
+					t.Errorf("%v: unit %q is not a suffix of the name", name, unit)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package collector
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"go.uber.org/zap"
+)
+
+const (
+	faultHistoryWindow      = time.Hour * 24
+	unknownFaultCode        = "unknown"
+	unknownFaultDescription = "Unknown fault"
+)
+
+// faultDescriptions maps the fault codes reported in currentFault to the fault messages
+// listed in the troubleshooting section of the Fox ESS inverter manuals.
+var faultDescriptions = map[int]string{
+	1:  "Grid Lost Fault",
+	2:  "Grid Voltage Fault",
+	3:  "Grid Frequency Fault",
+	4:  "10min Grid Voltage Fault",
+	5:  "EPS Over Load Fault",
+	6:  "Bus Voltage Fault",
+	7:  "Bus Voltage Unbalance Fault",
+	8:  "Inverter Current Fault",
+	9:  "DCI Fault",
+	10: "DCV Fault",
+	11: "Residual Current Fault",
+	12: "Isolation Fault",
+	13: "PV Voltage Fault",
+	14: "PV Current Fault",
+	15: "Over Temperature Fault",
+	16: "Low Temperature Fault",
+	17: "Fan Fault",
+	18: "Ground Fault",
+	19: "Battery Voltage Fault",
+	20: "Battery Current Fault",
+	21: "Battery Power Low",
+	22: "Battery Lost",
+	23: "BMS Communication Fault",
+	24: "BMS Internal Fault",
+	25: "Meter Lost Fault",
+	26: "Meter Communication Fault",
+	27: "ARM-DSP Communication Fault",
+	28: "EEPROM Fault",
+	29: "Relay Fault",
+	30: "Sampling Fault",
+	31: "Software Version Mismatch",
+	32: "Parallel Communication Fault",
+	33: "Arc Fault",
+	34: "Inverter Overload Fault",
+	35: "Boost Over Current Fault",
+	36: "Grid Reverse Connection Fault",
+}
+
+type fault struct {
+	Code        string
+	Description string
+}
+
+// parseFaults parses the currentFault value, which is either a single fault code
+// or a comma separated list of fault codes or descriptions.
+func parseFaults(value string) []fault {
+	var res []fault
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		item = strings.TrimSpace(item)
+		if item == "" || item == "0" {
+			continue
+		}
+		f := lookupFault(item)
+		if !slices.Contains(res, f) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// lookupFault returns the fault of the item, which is either a fault code or a fault message.
+func lookupFault(item string) fault {
+	if code, err := strconv.Atoi(item); err == nil {
+		if desc, ok := faultDescriptions[code]; ok {
+			return fault{Code: item, Description: desc}
+		}
+		return fault{Code: item, Description: unknownFaultDescription}
+	}
+	for code, desc := range faultDescriptions {
+		if strings.EqualFold(desc, item) {
+			return fault{Code: strconv.Itoa(code), Description: desc}
+		}
+	}
+	return fault{Code: unknownFaultCode, Description: item}
+}
+
+func (e *Exporter) fetchFaultHistory(ctx context.Context) {
+	acc, ok := e.accounts[config.DefaultAccount]
+	if !ok {
+		return
+	}
+
+	ctx, span := e.tracer.Start(ctx, "fetch fault history")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, e.cycleTimeout)
+	defer cancel()
+
+	end := time.Now()
+	begin := end.Add(-faultHistoryWindow)
+
+	for _, inverterSN := range e.inverters {
+		if err := e.fetchInverterFaultHistory(ctx, acc, inverterSN, begin, end); err != nil {
+			recordError(span, err)
+			e.logger(ctx).Error("could not fetch inverter fault history", zap.String("inverter_sn", inverterSN), zap.Error(err))
+		}
+	}
+}
+
+func (e *Exporter) fetchInverterFaultHistory(ctx context.Context, acc account, inverterSN string, begin, end time.Time) error {
+	e.logger(ctx).Debug("fetching inverter fault history", zap.String("inverter_sn", inverterSN))
+
+	if err := e.waitRequest(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	data, err := acc.api.GetHistoryData(ctx, inverterSN, []foxesscloud.Variable{foxesscloud.VariableCurrentFault}, begin, end)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range data {
+		for _, dataItem := range item.Datas {
+			if dataItem.Variable != foxesscloud.VariableCurrentFault {
+				continue
+			}
+			for _, point := range dataItem.Data {
+				e.faultHistory.record(inverterSN, parseFaults(point.String()), point.Time.Time)
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) logFaultTransitions(prev, next []metricData) {
+	prevFaults := make(map[string][]fault, len(prev))
+	for _, d := range prev {
+		prevFaults[d.InverterSN] = d.Faults
+	}
+
+	for _, d := range next {
+		old := prevFaults[d.InverterSN]
+		for _, f := range d.Faults {
+			if !slices.Contains(old, f) {
+				e.log.Warn("inverter fault appeared",
+					zap.String("inverter_sn", d.InverterSN),
+					zap.String("code", f.Code),
+					zap.String("description", f.Description),
+				)
+			}
+		}
+		for _, f := range old {
+			if !slices.Contains(d.Faults, f) {
+				e.log.Info("inverter fault cleared",
+					zap.String("inverter_sn", d.InverterSN),
+					zap.String("code", f.Code),
+					zap.String("description", f.Description),
+				)
+			}
+		}
+	}
+}
+
+type faultHistory struct {
+	mu       sync.Mutex
+	lastSeen map[string]map[fault]time.Time
+}
+
+func newFaultHistory() *faultHistory {
+	return &faultHistory{
+		lastSeen: make(map[string]map[fault]time.Time),
+	}
+}
+
+func (h *faultHistory) record(inverterSN string, faults []fault, ts time.Time) {
+	if len(faults) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	seen, ok := h.lastSeen[inverterSN]
+	if !ok {
+		seen = make(map[fault]time.Time)
+		h.lastSeen[inverterSN] = seen
+	}
+	for _, f := range faults {
+		if ts.After(seen[f]) {
+			seen[f] = ts
+		}
+	}
+}
+
+func (h *faultHistory) get(inverterSN string) map[fault]time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return maps.Clone(h.lastSeen[inverterSN])
+}
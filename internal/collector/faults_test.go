@@ -0,0 +1,26 @@
+package collector
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseFaults(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []fault
+	}{
+		{value: "", want: nil},
+		{value: "0", want: nil},
+		{value: "1", want: []fault{{Code: "1", Description: "Grid Lost Fault"}}},
+		{value: "12, 17;12", want: []fault{{Code: "12", Description: "Isolation Fault"}, {Code: "17", Description: "Fan Fault"}}},
+		{value: "999", want: []fault{{Code: "999", Description: unknownFaultDescription}}},
+		{value: "fan fault", want: []fault{{Code: "17", Description: "Fan Fault"}}},
+		{value: "Meter Lost", want: []fault{{Code: unknownFaultCode, Description: "Meter Lost"}}},
+	}
+	for _, test := range tests {
+		if got := parseFaults(test.value); !slices.Equal(got, test.want) {
+			t.Errorf("%q: expected %v, got %v", test.value, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/modbus"
+	"go.uber.org/zap"
+)
+
+const (
+	sourceCloud = "cloud"
+	sourceLocal = "local"
+)
+
+type localSource struct {
+	client *modbus.Client
+	unitID byte
+}
+
+func newLocalSources(inverters []config.LocalInverter, timeout time.Duration) map[string]localSource {
+	res := make(map[string]localSource, len(inverters))
+	for _, inv := range inverters {
+		res[inv.InverterSN] = localSource{
+			client: modbus.NewClient(inv.Address, timeout),
+			unitID: inv.UnitID,
+		}
+	}
+	return res
+}
+
+// fetchLocalData reads the inverter data over Modbus TCP, it is used when the cloud is unreachable.
+func (e *Exporter) fetchLocalData(ctx context.Context, inverterSN string, local localSource) (metricData, error) {
+	ctx, span := e.tracer.Start(ctx, "fetch local inverter data")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	e.logger(ctx).Debug("fetching local inverter data", zap.String("inverter_sn", inverterSN))
+
+	values, err := modbus.ReadVariables(ctx, local.client, local.unitID, modbus.FoxESSRegisters)
+	if err != nil {
+		recordError(span, err)
+		return metricData{}, err
+	}
+
+	// the registers carry no timestamp, the reading is as old as the read and is kept in the time zone
+	// of the cloud readings, so that daily energy resets at the same midnight regardless of the source
+	updateTime := time.Now().Truncate(time.Second)
+	prev, hasPrev := e.latestData(inverterSN)
+	if hasPrev {
+		updateTime = updateTime.In(prev.UpdateTime.Location())
+	}
+
+	d := metricData{
+		InverterSN: inverterSN,
+		Source:     sourceLocal,
+		UpdateTime: updateTime,
+		Variables:  make(map[foxesscloud.Variable]bool),
+	}
+	for variable, value := range values {
+		// registers of strings which are not installed read as zero, keep the strings of the previous reading
+		if _, _, ok := parsePVStringVariable(variable); ok && hasPrev && prev.Variables != nil && !prev.Variables[variable] {
+			continue
+		}
+		d.setVariable(variable, value)
+	}
+	if code := values[foxesscloud.VariableCurrentFault]; code > 0 {
+		d.Faults = parseFaults(strconv.Itoa(int(code)))
+	}
+	return d, nil
+}
+
+func (e *Exporter) logSourceTransitions(prev, next []metricData) {
+	prevSources := make(map[string]string, len(prev))
+	for _, d := range prev {
+		prevSources[d.InverterSN] = d.Source
+	}
+
+	for _, d := range next {
+		if old, ok := prevSources[d.InverterSN]; ok && old != d.Source {
+			e.log.Warn("inverter data source changed",
+				zap.String("inverter_sn", d.InverterSN),
+				zap.String("from", old),
+				zap.String("to", d.Source),
+			)
+		}
+	}
+}
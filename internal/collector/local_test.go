@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/fakeapi"
+	"github.com/jbub/foxesscloud_exporter/internal/modbus"
+)
+
+// newTestLocalInverter serves the readings of the simulated inverter over Modbus TCP.
+func newTestLocalInverter(t *testing.T, readings map[foxesscloud.Variable]float64) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	regs := modbus.NewRegisters()
+	regs.Set(1, modbus.EncodeVariables(readings, modbus.FoxESSRegisters))
+	srv := modbus.NewServer(regs)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func TestFetchInvertersLocalFallback(t *testing.T) {
+	for _, path := range fetchPaths {
+		t.Run(path.name, func(t *testing.T) {
+			api, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}, Location: time.FixedZone("CEST", 2*60*60)})
+			readings := api.Readings("sn-1", testNow)
+			cfg := testConfig("sn-1")
+			cfg.APIBatchSize = path.batchSize
+			cfg.LocalInverters = []config.LocalInverter{{InverterSN: "sn-1", Address: newTestLocalInverter(t, readings), UnitID: 1}}
+
+			var cloudDown atomic.Bool
+			transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if cloudDown.Load() {
+					return nil, errors.New("cloud unreachable")
+				}
+				return http.DefaultTransport.RoundTrip(req)
+			})
+			exp := newTestExporter(t, cfg, srv.URL, testToken, transport)
+
+			data, err := exp.fetchInverters(context.Background(), exp.inverters)
+			if err != nil {
+				t.Fatalf("could not fetch inverters: %v", err)
+			}
+			if data[0].Source != sourceCloud {
+				t.Fatalf("expected source %v, got %v", sourceCloud, data[0].Source)
+			}
+			exp.storeData(data)
+			cloudTime := data[0].UpdateTime
+
+			cloudDown.Store(true)
+			before := time.Now().Truncate(time.Second)
+			data, err = exp.fetchInverters(context.Background(), exp.inverters)
+			if err != nil {
+				t.Fatalf("could not fetch inverters: %v", err)
+			}
+			after := time.Now()
+
+			d := data[0]
+			if d.Source != sourceLocal {
+				t.Fatalf("expected source %v, got %v", sourceLocal, d.Source)
+			}
+			if d.UpdateTime.Before(before) || d.UpdateTime.After(after) {
+				t.Errorf("expected update time between %v and %v, got %v", before, after, d.UpdateTime)
+			}
+			if d.UpdateTime.Location() != cloudTime.Location() {
+				t.Errorf("expected update time in %v, got %v", cloudTime.Location(), d.UpdateTime.Location())
+			}
+
+			// registers hold watts and tenths, the values are within the register resolution of the readings
+			tests := []struct {
+				name string
+				got  float64
+				want float64
+			}{
+				{name: "photovoltaic power", got: d.PhotovoltaicPower, want: readings[foxesscloud.VariablePvPower]},
+				{name: "load power", got: d.LoadPower, want: readings[foxesscloud.VariableLoadsPower]},
+				{name: "feed in power", got: d.FeedInPower, want: readings[foxesscloud.VariableFeedinPower]},
+				{name: "output power", got: d.OutputPower, want: readings[foxesscloud.VariableGenerationPower]},
+				{name: "inverter temperature", got: d.InverterTemperature, want: readings[foxesscloud.VariableInvTemperation]},
+				{name: "generation", got: d.TotalGeneratedPower, want: readings[foxesscloud.VariableGeneration]},
+			}
+			for _, test := range tests {
+				if math.Abs(test.got-test.want) > 0.05 {
+					t.Errorf("%v: expected %v, got %v", test.name, test.want, test.got)
+				}
+			}
+			if len(d.PVStrings) != 2 {
+				t.Errorf("expected 2 PV strings, got %v", len(d.PVStrings))
+			}
+
+			exp.storeData(data)
+			labels := map[string]string{inverterSNLabel: "sn-1", sourceLabel: sourceLocal}
+			v, ok := gatherValue(t, NewRegistry(exp), "foxesscloud_load_power_kw", labels)
+			if !ok {
+				t.Fatal("expected load power metric with local source")
+			}
+			if math.Abs(v-readings[foxesscloud.VariableLoadsPower]) > 0.001 {
+				t.Errorf("expected load power %v, got %v", readings[foxesscloud.VariableLoadsPower], v)
+			}
+		})
+	}
+}
+
+func TestFetchInvertersLocalFallbackFailed(t *testing.T) {
+	_, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}, RateLimitProbability: 1})
+	cfg := testConfig("sn-1")
+	cfg.LocalInverters = []config.LocalInverter{{InverterSN: "sn-1", Address: newTestLocalInverter(t, nil), UnitID: 2}}
+	exp := newTestExporter(t, cfg, srv.URL, testToken, nil)
+
+	_, err := exp.fetchInverters(context.Background(), exp.inverters)
+	var exc *modbus.ExceptionError
+	if !errors.As(err, &exc) {
+		t.Fatalf("expected modbus exception, got %v", err)
+	}
+}
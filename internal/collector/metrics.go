@@ -1,242 +1,545 @@
 package collector
 
 import (
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/config"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-func buildMetrics() []metric {
-	return []metric{
+const (
+	unitCelsius = "celsius"
+	unitSeconds = "seconds"
+	unitVolts   = "volts"
+	unitAmperes = "amperes"
+	unitWatts   = "watts"
+	unitJoules  = "joules"
+	unitHertz   = "hertz"
+	unitRatio   = "ratio"
+
+	wattsPerKW   = 1000
+	joulesPerKWh = 3.6e6
+)
+
+// buildMetrics returns the metrics of the naming scheme, legacy and v2 are both returned for the both scheme.
+func buildMetrics(cfg config.Config) []metric {
+	metrics := []metric{
 		{
-			name:    "ambient_temperature_celsius",
-			help:    "Internal temperature of the inverter in celsius.",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.AmbientTemperature },
+			name:      "ambient_temperature_celsius",
+			help:      "Internal temperature of the inverter in celsius.",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.AmbientTemperature },
+			variables: []foxesscloud.Variable{foxesscloud.VariableAmbientTemperation},
+			unit:      unitCelsius,
 		},
 		{
-			name:    "boost_temperature_celsius",
-			help:    "Boost temperature of the inverter in celsius.",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.BoostTemperature },
+			name:      "boost_temperature_celsius",
+			help:      "Boost temperature of the inverter in celsius.",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.BoostTemperature },
+			variables: []foxesscloud.Variable{foxesscloud.VariableBoostTemperation},
+			unit:      unitCelsius,
 		},
 		{
-			name:    "inverter_temperature_celsius",
-			help:    "Temperature of the inverter in celsius.",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.InverterTemperature },
+			name:      "inverter_temperature_celsius",
+			help:      "Temperature of the inverter in celsius.",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.InverterTemperature },
+			variables: []foxesscloud.Variable{foxesscloud.VariableInvTemperation},
+			unit:      unitCelsius,
 		},
 		{
-			name:    "generated_power_today_kwh",
-			help:    "Today generated power",
-			valType: prometheus.CounterValue,
-			eval:    func(data metricData) float64 { return data.TodayGeneratedPower },
+			name:      "generated_power_today_kwh",
+			help:      "Today generated power, resets every midnight in the inverter's timezone.",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.TodayGeneratedPower },
+			variables: []foxesscloud.Variable{foxesscloud.VariableTodayYield},
 		},
 		{
-			name:    "generated_power_total_kwh",
-			help:    "Total generated power",
-			valType: prometheus.CounterValue,
-			eval:    func(data metricData) float64 { return data.TotalGeneratedPower },
+			name:      "generated_power_total_kwh",
+			help:      "Total generated power",
+			valType:   prometheus.CounterValue,
+			eval:      func(data metricData) float64 { return data.TotalGeneratedPower },
+			variables: []foxesscloud.Variable{foxesscloud.VariableGeneration},
 		},
 		{
-			name:    "photovoltaic_power_kwh",
-			help:    "Photovoltaic power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PhotovoltaicPower },
+			name:      "generated_energy_kwh_total",
+			help:      "Generated energy accumulated by the exporter from today generated power, does not reset at midnight.",
+			valType:   prometheus.CounterValue,
+			eval:      func(data metricData) float64 { return data.GeneratedEnergyTotal },
+			variables: []foxesscloud.Variable{foxesscloud.VariableTodayYield},
 		},
 		{
-			name:    "load_power_kw",
-			help:    "Load power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.LoadPower },
+			name:      "photovoltaic_power_kwh",
+			help:      "Photovoltaic power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PhotovoltaicPower },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePvPower},
 		},
 		{
-			name:    "feed_in_power_kw",
-			help:    "Feed-in power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.FeedInPower },
+			name:      "load_power_kw",
+			help:      "Load power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.LoadPower },
+			variables: []foxesscloud.Variable{foxesscloud.VariableLoadsPower},
 		},
 		{
-			name:    "output_power_kw",
-			help:    "Output power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.OutputPower },
+			name:      "feed_in_power_kw",
+			help:      "Feed-in power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.FeedInPower },
+			variables: []foxesscloud.Variable{foxesscloud.VariableFeedinPower},
 		},
 		{
-			name:    "grid_consumption_power_kw",
-			help:    "Grid consumption power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.GridConsumptionPower },
+			name:      "output_power_kw",
+			help:      "Output power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.OutputPower },
+			variables: []foxesscloud.Variable{foxesscloud.VariableGenerationPower},
 		},
 		{
-			name:    "pv1_voltage_v",
-			help:    "PV1 voltage",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV1Voltage },
+			name:      "grid_consumption_power_kw",
+			help:      "Grid consumption power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.GridConsumptionPower },
+			variables: []foxesscloud.Variable{foxesscloud.VariableGridConsumptionPower},
 		},
 		{
-			name:    "pv1_current_amp",
-			help:    "PV1 current",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV1Current },
+			name:      "pv1_voltage_v",
+			help:      "PV1 voltage",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV1Voltage },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv1Volt},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "pv1_power_kw",
-			help:    "PV1 power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV1Power },
+			name:      "pv1_current_amp",
+			help:      "PV1 current",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV1Current },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv1Current},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "pv2_voltage_v",
-			help:    "PV2 voltage",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV2Voltage },
+			name:      "pv1_power_kw",
+			help:      "PV1 power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV1Power },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv1Power},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "pv2_current_amp",
-			help:    "PV2 current",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV2Current },
+			name:      "pv2_voltage_v",
+			help:      "PV2 voltage",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV2Voltage },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv2Volt},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "pv2_power_kw",
-			help:    "PV2 power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV2Power },
+			name:      "pv2_current_amp",
+			help:      "PV2 current",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV2Current },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv2Current},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "pv3_voltage_v",
-			help:    "PV3 voltage",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV3Voltage },
+			name:      "pv2_power_kw",
+			help:      "PV2 power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV2Power },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv2Power},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "pv3_current_amp",
-			help:    "PV3 current",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV3Current },
+			name:      "pv3_voltage_v",
+			help:      "PV3 voltage",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV3Voltage },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv3Volt},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "pv3_power_kw",
-			help:    "PV3 power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV3Power },
+			name:      "pv3_current_amp",
+			help:      "PV3 current",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV3Current },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv3Current},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "pv4_voltage_v",
-			help:    "PV4 voltage",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV4Voltage },
+			name:      "pv3_power_kw",
+			help:      "PV3 power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV3Power },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv3Power},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "pv4_current_amp",
-			help:    "PV4 current",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV4Current },
+			name:      "pv4_voltage_v",
+			help:      "PV4 voltage",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV4Voltage },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv4Volt},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "pv4_power_kw",
-			help:    "PV4 power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.PV4Power },
+			name:      "pv4_current_amp",
+			help:      "PV4 current",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV4Current },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv4Current},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "reference_frequency_hz",
-			help:    "Reference frequency",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.ReferenceFrequency },
+			name:      "pv4_power_kw",
+			help:      "PV4 power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.PV4Power },
+			variables: []foxesscloud.Variable{foxesscloud.VariablePv4Power},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "reference_voltage_v",
-			help:    "Reference voltage",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.ReferenceVoltage },
+			name:      "reference_frequency_hz",
+			help:      "Reference frequency",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.ReferenceFrequency },
+			variables: []foxesscloud.Variable{foxesscloud.VariableRFreq},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "reference_current_amp",
-			help:    "Reference current",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.ReferenceCurrent },
+			name:      "reference_voltage_v",
+			help:      "Reference voltage",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.ReferenceVoltage },
+			variables: []foxesscloud.Variable{foxesscloud.VariableRVolt},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "reference_power_kw",
-			help:    "Reference power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.ReferencePower },
+			name:      "reference_current_amp",
+			help:      "Reference current",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.ReferenceCurrent },
+			variables: []foxesscloud.Variable{foxesscloud.VariableRCurrent},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "secondary_frequency_hz",
-			help:    "Secondary frequency",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.SecondaryFrequency },
+			name:      "reference_power_kw",
+			help:      "Reference power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.ReferencePower },
+			variables: []foxesscloud.Variable{foxesscloud.VariableRPower},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "secondary_voltage_v",
-			help:    "Secondary voltage",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.SecondaryVoltage },
+			name:      "secondary_frequency_hz",
+			help:      "Secondary frequency",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.SecondaryFrequency },
+			variables: []foxesscloud.Variable{foxesscloud.VariableSFreq},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "secondary_current_amp",
-			help:    "Secondary current",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.SecondaryCurrent },
+			name:      "secondary_voltage_v",
+			help:      "Secondary voltage",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.SecondaryVoltage },
+			variables: []foxesscloud.Variable{foxesscloud.VariableSVolt},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "secondary_power_kw",
-			help:    "Secondary power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.SecondaryPower },
+			name:      "secondary_current_amp",
+			help:      "Secondary current",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.SecondaryCurrent },
+			variables: []foxesscloud.Variable{foxesscloud.VariableSCurrent},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "tertiary_frequency_hz",
-			help:    "Tertiary frequency",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.TertiaryFrequency },
+			name:      "secondary_power_kw",
+			help:      "Secondary power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.SecondaryPower },
+			variables: []foxesscloud.Variable{foxesscloud.VariableSPower},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "tertiary_voltage_v",
-			help:    "Tertiary voltage",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.TertiaryVoltage },
+			name:      "tertiary_frequency_hz",
+			help:      "Tertiary frequency",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.TertiaryFrequency },
+			variables: []foxesscloud.Variable{foxesscloud.VariableTFreq},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "tertiary_current_amp",
-			help:    "Tertiary current",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.TertiaryCurrent },
+			name:      "tertiary_voltage_v",
+			help:      "Tertiary voltage",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.TertiaryVoltage },
+			variables: []foxesscloud.Variable{foxesscloud.VariableTVolt},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "tertiary_power_kw",
-			help:    "Tertiary power",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.TertiaryPower },
+			name:      "tertiary_current_amp",
+			help:      "Tertiary current",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.TertiaryCurrent },
+			variables: []foxesscloud.Variable{foxesscloud.VariableTCurrent},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "fault_count",
-			help:    "Number of errors reported.",
-			valType: prometheus.CounterValue,
-			eval:    func(data metricData) float64 { return data.FaultCount },
+			name:      "tertiary_power_kw",
+			help:      "Tertiary power",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.TertiaryPower },
+			variables: []foxesscloud.Variable{foxesscloud.VariableTPower},
+			naming:    config.MetricNamingLegacy,
 		},
 		{
-			name:    "running_state",
-			help:    "Running state.",
-			valType: prometheus.GaugeValue,
-			eval:    func(data metricData) float64 { return data.RunningState },
+			name:      "fault_count",
+			help:      "Number of errors reported.",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.FaultCount },
+			variables: []foxesscloud.Variable{foxesscloud.VariableCurrentFaultCount},
+		},
+		{
+			name:      "running_state",
+			help:      "Running state.",
+			valType:   prometheus.GaugeValue,
+			eval:      func(data metricData) float64 { return data.RunningState },
+			variables: []foxesscloud.Variable{foxesscloud.VariableRunningState},
 		},
 		{
 			name:    "last_updated_timestamp_seconds",
 			help:    "Timestamp of the last update in seconds.",
-			valType: prometheus.CounterValue,
+			valType: prometheus.GaugeValue,
 			eval:    func(data metricData) float64 { return float64(data.UpdateTime.Unix()) },
+			unit:    unitSeconds,
+		},
+		{
+			name:       "data_age_seconds",
+			help:       "Age of the last update in seconds.",
+			valType:    prometheus.GaugeValue,
+			eval:       func(data metricData) float64 { return time.Since(data.UpdateTime).Seconds() },
+			scrapeTime: true,
+			unit:       unitSeconds,
+		},
+	}
+
+	metrics = append(metrics, gridMetrics()...)
+	metrics = append(metrics, pvStringMetrics()...)
+	metrics = append(metrics, efficiencyMetrics(cfg.EfficiencyMinPower, cfg.EfficiencyThreshold)...)
+
+	for _, ip := range integratedPowers() {
+		m := metric{
+			name:      ip.name + "_energy_kwh_total",
+			help:      ip.help,
+			valType:   prometheus.CounterValue,
+			eval:      func(data metricData) float64 { return data.IntegratedEnergy[ip.name] },
+			variables: []foxesscloud.Variable{ip.variable},
+		}
+		if ip.pvString == 0 {
+			metrics = append(metrics, m)
+			continue
+		}
+
+		// legacy metrics cover only the first strings, v2 exposes all strings labelled by their number
+		if ip.pvString <= legacyPVStrings {
+			m.naming = config.MetricNamingLegacy
+			metrics = append(metrics, m)
+		}
+		metrics = append(metrics, metric{
+			name:      "pv_string_energy_joules_total",
+			help:      "PV string energy integrated by the exporter from PV string power in joules.",
+			valType:   prometheus.CounterValue,
+			eval:      func(data metricData) float64 { return data.IntegratedEnergy[ip.name] * joulesPerKWh },
+			variables: []foxesscloud.Variable{ip.variable},
+			labels:    prometheus.Labels{stringLabel: strconv.Itoa(ip.pvString)},
+			naming:    config.MetricNamingV2,
+			unit:      unitJoules,
+		})
+	}
+
+	// metrics not named in base units are legacy, v2 exposes them in base units
+	for i, m := range metrics {
+		name, unit, scale, ok := baseUnitName(m.name)
+		if !ok || m.naming != "" {
+			continue
+		}
+		metrics[i].naming = config.MetricNamingLegacy
+
+		eval := m.eval
+		m.name = name
+		m.unit = unit
+		m.eval = func(data metricData) float64 { return eval(data) * scale }
+		m.naming = config.MetricNamingV2
+		metrics = append(metrics, m)
+	}
+
+	if cfg.MetricNaming == config.MetricNamingBoth {
+		return metrics
+	}
+	return slices.DeleteFunc(metrics, func(m metric) bool {
+		return m.naming != "" && m.naming != cfg.MetricNaming
+	})
+}
+
+// baseUnitName returns the v2 name, unit and scale of legacy metrics not named in base units.
+func baseUnitName(name string) (string, string, float64, bool) {
+	switch name {
+	case "generated_power_today_kwh":
+		return "generated_energy_today_joules", unitJoules, joulesPerKWh, true
+	case "generated_power_total_kwh":
+		return "generated_energy_lifetime_joules_total", unitJoules, joulesPerKWh, true
+	case "photovoltaic_power_kwh":
+		return "photovoltaic_power_watts", unitWatts, wattsPerKW, true
+	}
+	if base, ok := strings.CutSuffix(name, "_power_kw"); ok {
+		return base + "_power_watts", unitWatts, wattsPerKW, true
+	}
+	if base, ok := strings.CutSuffix(name, "_energy_kwh_total"); ok {
+		return base + "_energy_joules_total", unitJoules, joulesPerKWh, true
+	}
+	return "", "", 0, false
+}
+
+type gridValue struct {
+	variable foxesscloud.Variable
+	eval     func(data metricData) float64
+}
+
+// gridMetrics returns the grid metrics of the R, S and T phases labelled as L1, L2 and L3 in base units,
+// they replace the reference, secondary and tertiary metrics.
+func gridMetrics() []metric {
+	phases := []struct {
+		phase                              string
+		voltage, current, power, frequency gridValue
+	}{
+		{
+			phase:     "L1",
+			voltage:   gridValue{foxesscloud.VariableRVolt, func(data metricData) float64 { return data.ReferenceVoltage }},
+			current:   gridValue{foxesscloud.VariableRCurrent, func(data metricData) float64 { return data.ReferenceCurrent }},
+			power:     gridValue{foxesscloud.VariableRPower, func(data metricData) float64 { return data.ReferencePower }},
+			frequency: gridValue{foxesscloud.VariableRFreq, func(data metricData) float64 { return data.ReferenceFrequency }},
+		},
+		{
+			phase:     "L2",
+			voltage:   gridValue{foxesscloud.VariableSVolt, func(data metricData) float64 { return data.SecondaryVoltage }},
+			current:   gridValue{foxesscloud.VariableSCurrent, func(data metricData) float64 { return data.SecondaryCurrent }},
+			power:     gridValue{foxesscloud.VariableSPower, func(data metricData) float64 { return data.SecondaryPower }},
+			frequency: gridValue{foxesscloud.VariableSFreq, func(data metricData) float64 { return data.SecondaryFrequency }},
+		},
+		{
+			phase:     "L3",
+			voltage:   gridValue{foxesscloud.VariableTVolt, func(data metricData) float64 { return data.TertiaryVoltage }},
+			current:   gridValue{foxesscloud.VariableTCurrent, func(data metricData) float64 { return data.TertiaryCurrent }},
+			power:     gridValue{foxesscloud.VariableTPower, func(data metricData) float64 { return data.TertiaryPower }},
+			frequency: gridValue{foxesscloud.VariableTFreq, func(data metricData) float64 { return data.TertiaryFrequency }},
 		},
 	}
+
+	var metrics []metric
+	for _, p := range phases {
+		labels := prometheus.Labels{phaseLabel: p.phase}
+		metrics = append(metrics,
+			metric{
+				name:      "grid_voltage_volts",
+				help:      "Grid phase voltage in volts.",
+				valType:   prometheus.GaugeValue,
+				eval:      p.voltage.eval,
+				variables: []foxesscloud.Variable{p.voltage.variable},
+				labels:    labels,
+				naming:    config.MetricNamingV2,
+				unit:      unitVolts,
+			},
+			metric{
+				name:      "grid_current_amperes",
+				help:      "Grid phase current in amperes.",
+				valType:   prometheus.GaugeValue,
+				eval:      p.current.eval,
+				variables: []foxesscloud.Variable{p.current.variable},
+				labels:    labels,
+				naming:    config.MetricNamingV2,
+				unit:      unitAmperes,
+			},
+			metric{
+				name:      "grid_power_watts",
+				help:      "Grid phase power in watts.",
+				valType:   prometheus.GaugeValue,
+				eval:      func(data metricData) float64 { return p.power.eval(data) * wattsPerKW },
+				variables: []foxesscloud.Variable{p.power.variable},
+				labels:    labels,
+				naming:    config.MetricNamingV2,
+				unit:      unitWatts,
+			},
+			metric{
+				name:      "grid_frequency_hertz",
+				help:      "Grid phase frequency in hertz.",
+				valType:   prometheus.GaugeValue,
+				eval:      p.frequency.eval,
+				variables: []foxesscloud.Variable{p.frequency.variable},
+				labels:    labels,
+				naming:    config.MetricNamingV2,
+				unit:      unitHertz,
+			},
+		)
+	}
+	return metrics
+}
+
+// pvStringMetrics returns the string labelled PV metrics in base units, they replace the pv1 to pv4 metrics.
+func pvStringMetrics() []metric {
+	var metrics []metric
+	for n := 1; n <= maxPVStrings; n++ {
+		labels := prometheus.Labels{stringLabel: strconv.Itoa(n)}
+		metrics = append(metrics,
+			metric{
+				name:      "pv_string_voltage_volts",
+				help:      "PV string voltage in volts.",
+				valType:   prometheus.GaugeValue,
+				eval:      func(data metricData) float64 { return data.PVStrings[n].Voltage },
+				variables: []foxesscloud.Variable{pvStringVariable(n, pvStringVoltage)},
+				labels:    labels,
+				naming:    config.MetricNamingV2,
+				unit:      unitVolts,
+			},
+			metric{
+				name:      "pv_string_current_amperes",
+				help:      "PV string current in amperes.",
+				valType:   prometheus.GaugeValue,
+				eval:      func(data metricData) float64 { return data.PVStrings[n].Current },
+				variables: []foxesscloud.Variable{pvStringVariable(n, pvStringCurrent)},
+				labels:    labels,
+				naming:    config.MetricNamingV2,
+				unit:      unitAmperes,
+			},
+			metric{
+				name:      "pv_string_power_watts",
+				help:      "PV string power in watts.",
+				valType:   prometheus.GaugeValue,
+				eval:      func(data metricData) float64 { return data.PVStrings[n].Power * wattsPerKW },
+				variables: []foxesscloud.Variable{pvStringVariable(n, pvStringPower)},
+				labels:    labels,
+				naming:    config.MetricNamingV2,
+				unit:      unitWatts,
+			},
+		)
+	}
+	return metrics
 }
 
 type metricData struct {
 	InverterSN   string
+	Source       string
+	Restored     bool `json:"-"`
 	RunningState float64
 	FaultCount   float64
+	Faults       []fault
 
 	AmbientTemperature  float64
 	BoostTemperature    float64
@@ -250,6 +553,11 @@ type metricData struct {
 	OutputPower          float64
 	GridConsumptionPower float64
 
+	GeneratedEnergyTotal float64
+	IntegratedEnergy     map[string]float64
+	// TodayEnergy is the integrated energy since the start of the day
+	TodayEnergy map[string]float64
+
 	PV1Power   float64
 	PV1Voltage float64
 	PV1Current float64
@@ -266,6 +574,11 @@ type metricData struct {
 	PV4Voltage float64
 	PV4Current float64
 
+	// PVStrings are all PV strings reported by the inverter by their number
+	PVStrings map[int]pvString
+	// Variables are the variables present in the reading, readings restored from older state do not track them
+	Variables map[foxesscloud.Variable]bool
+
 	ReferencePower     float64
 	ReferenceVoltage   float64
 	ReferenceCurrent   float64
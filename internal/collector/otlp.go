@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+)
+
+// otlpUnits maps the OpenMetrics units to UCUM units used by OpenTelemetry.
+var otlpUnits = map[string]string{
+	unitCelsius: "Cel",
+	unitSeconds: "s",
+	unitVolts:   "V",
+	unitAmperes: "A",
+	unitWatts:   "W",
+	unitJoules:  "J",
+	unitHertz:   "Hz",
+	unitRatio:   "1",
+}
+
+// meterInstruments holds a single instrument per metric name, metrics sharing a name, e.g. the grid phases
+// or PV strings, are observed on the same instrument with different attributes.
+type meterInstruments struct {
+	meter       otelmetric.Meter
+	instruments map[string]otelmetric.Float64Observable
+	observables []otelmetric.Observable
+}
+
+func (i *meterInstruments) add(name string, help string, unit string, valType prometheus.ValueType) error {
+	name = prometheus.BuildFQName("foxesscloud", "", name)
+	if _, ok := i.instruments[name]; ok {
+		return nil
+	}
+
+	var inst otelmetric.Float64Observable
+	var err error
+	switch valType {
+	case prometheus.CounterValue:
+		inst, err = i.meter.Float64ObservableCounter(name, otelmetric.WithDescription(help), otelmetric.WithUnit(otlpUnits[unit]))
+	default:
+		inst, err = i.meter.Float64ObservableGauge(name, otelmetric.WithDescription(help), otelmetric.WithUnit(otlpUnits[unit]))
+	}
+	if err != nil {
+		return fmt.Errorf("could not create instrument %v: %w", name, err)
+	}
+	i.instruments[name] = inst
+	i.observables = append(i.observables, inst)
+	return nil
+}
+
+func (i *meterInstruments) get(name string) otelmetric.Float64Observable {
+	return i.instruments[prometheus.BuildFQName("foxesscloud", "", name)]
+}
+
+// RegisterMeter registers observable instruments for the inverter metrics exposed to Prometheus, counters are exported
+// as cumulative sums and all other metrics as gauges. Default labels are expected to be set as resource attributes.
+func (e *Exporter) RegisterMeter(meter otelmetric.Meter) error {
+	insts := &meterInstruments{
+		meter:       meter,
+		instruments: make(map[string]otelmetric.Float64Observable),
+	}
+	for _, m := range e.metrics {
+		if err := insts.add(m.name, m.help, m.unit, m.valType); err != nil {
+			return err
+		}
+	}
+	for _, r := range e.ratios {
+		err := errors.Join(
+			insts.add(r.name+"_ratio", r.help, unitRatio, prometheus.GaugeValue),
+			insts.add(r.name+"_today_ratio", r.help+" Computed from the energy since the start of the day.", unitRatio, prometheus.GaugeValue),
+			insts.add("site_"+r.name+"_ratio", r.help+" Computed for all inverters together.", unitRatio, prometheus.GaugeValue),
+			insts.add("site_"+r.name+"_today_ratio", r.help+" Computed for all inverters together from the energy since the start of the day.", unitRatio, prometheus.GaugeValue),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	err := errors.Join(
+		insts.add("data_restored", "Whether the exported data was restored from the state file and not fetched yet.", "", prometheus.GaugeValue),
+		insts.add("variables_reported", "Number of variables reported in the last reading.", "", prometheus.GaugeValue),
+		insts.add("inverter_fault_active", "Whether the fault is currently active on the inverter.", "", prometheus.GaugeValue),
+		insts.add("inverter_fault_last_seen_timestamp_seconds", "Timestamp when the fault was last reported by the inverter in seconds.", unitSeconds, prometheus.GaugeValue),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o otelmetric.Observer) error {
+		data := e.data.Load()
+		if data == nil {
+			return nil
+		}
+		e.observeData(o, insts, *data)
+		return nil
+	}, insts.observables...)
+	if err != nil {
+		return fmt.Errorf("could not register callback: %w", err)
+	}
+	return nil
+}
+
+func (e *Exporter) observeData(o otelmetric.Observer, insts *meterInstruments, data []metricData) {
+	var site, siteToday powerFlows
+	for _, d := range data {
+		attrs := e.buildAttributes(d.InverterSN, d.Source)
+		for _, m := range e.metrics {
+			if !m.available(d) {
+				continue
+			}
+			metricAttrs := attrs
+			for k, v := range m.labels {
+				metricAttrs = append(slices.Clip(metricAttrs), attribute.String(k, v))
+			}
+			o.ObserveFloat64(insts.get(m.name), m.eval(d), otelmetric.WithAttributes(metricAttrs...))
+		}
+
+		if hasFlows(d) {
+			site = site.add(currentFlows(d))
+			siteToday = siteToday.add(todayFlows(d))
+			for _, r := range e.ratios {
+				if v, ok := r.ratio(currentFlows(d)); ok {
+					o.ObserveFloat64(insts.get(r.name+"_ratio"), v, otelmetric.WithAttributes(attrs...))
+				}
+				if v, ok := r.ratio(todayFlows(d)); ok {
+					o.ObserveFloat64(insts.get(r.name+"_today_ratio"), v, otelmetric.WithAttributes(attrs...))
+				}
+			}
+		}
+
+		o.ObserveFloat64(insts.get("data_restored"), boolToFloat(d.Restored), otelmetric.WithAttributes(attrs...))
+		o.ObserveFloat64(insts.get("variables_reported"), float64(len(d.Variables)), otelmetric.WithAttributes(attrs...))
+		for _, f := range d.Faults {
+			o.ObserveFloat64(insts.get("inverter_fault_active"), 1, otelmetric.WithAttributes(faultAttributes(attrs, f)...))
+		}
+		for f, ts := range e.faultHistory.get(d.InverterSN) {
+			o.ObserveFloat64(insts.get("inverter_fault_last_seen_timestamp_seconds"), float64(ts.Unix()), otelmetric.WithAttributes(faultAttributes(attrs, f)...))
+		}
+	}
+
+	for _, r := range e.ratios {
+		if v, ok := r.ratio(site); ok {
+			o.ObserveFloat64(insts.get("site_"+r.name+"_ratio"), v)
+		}
+		if v, ok := r.ratio(siteToday); ok {
+			o.ObserveFloat64(insts.get("site_"+r.name+"_today_ratio"), v)
+		}
+	}
+}
+
+func (e *Exporter) buildAttributes(inverterSN string, source string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String(inverterSNLabel, inverterSN)}
+	if len(e.local) > 0 {
+		attrs = append(attrs, attribute.String(sourceLabel, source))
+	}
+	return attrs
+}
+
+func faultAttributes(attrs []attribute.KeyValue, f fault) []attribute.KeyValue {
+	return append(slices.Clip(attrs), attribute.String(faultLabels[0], f.Code), attribute.String(faultLabels[1], f.Description))
+}
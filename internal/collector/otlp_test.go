@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/fakeapi"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRegisterMeter(t *testing.T) {
+	api, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}, FaultProbability: 1})
+	exp := newTestExporter(t, testConfig("sn-1"), srv.URL, testToken, nil)
+
+	data, err := exp.fetchInverters(context.Background(), exp.inverters)
+	if err != nil {
+		t.Fatalf("could not fetch inverters: %v", err)
+	}
+	exp.storeData(data)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	if err := exp.RegisterMeter(provider.Meter(Name)); err != nil {
+		t.Fatalf("could not register meter: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("could not collect metrics: %v", err)
+	}
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("expected 1 scope, got %v", len(rm.ScopeMetrics))
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if _, ok := metrics[m.Name]; ok {
+			t.Errorf("%v: instrument exported more than once", m.Name)
+		}
+		metrics[m.Name] = m
+	}
+
+	readings := api.Readings("sn-1", testNow)
+	tests := []struct {
+		name   string
+		unit   string
+		points int
+		attrs  []attribute.KeyValue
+		want   float64
+	}{
+		{name: "foxesscloud_load_power_watts", unit: "W", points: 1, want: readings[foxesscloud.VariableLoadsPower] * 1000},
+		{name: "foxesscloud_load_power_kw", unit: "", points: 1, want: readings[foxesscloud.VariableLoadsPower]},
+		{name: "foxesscloud_inverter_temperature_celsius", unit: "Cel", points: 1, want: readings[foxesscloud.VariableInvTemperation]},
+		{name: "foxesscloud_grid_voltage_volts", unit: "V", points: 3, attrs: []attribute.KeyValue{attribute.String(phaseLabel, "L2")}, want: readings[foxesscloud.VariableSVolt]},
+		{name: "foxesscloud_pv_string_power_watts", unit: "W", points: 2, attrs: []attribute.KeyValue{attribute.String(stringLabel, "1")}, want: readings[foxesscloud.VariablePv1Power] * 1000},
+		{name: "foxesscloud_data_restored", points: 1, want: 0},
+		{name: "foxesscloud_variables_reported", points: 1, want: float64(len(data[0].Variables))},
+		{name: "foxesscloud_inverter_fault_active", points: 1, attrs: []attribute.KeyValue{attribute.String("code", formatCode(readings[foxesscloud.VariableCurrentFault]))}, want: 1},
+	}
+	for _, test := range tests {
+		m, ok := metrics[test.name]
+		if !ok {
+			t.Errorf("%v: metric not found", test.name)
+			continue
+		}
+		if m.Unit != test.unit {
+			t.Errorf("%v: expected unit %q, got %q", test.name, test.unit, m.Unit)
+		}
+		gauge, ok := m.Data.(metricdata.Gauge[float64])
+		if !ok {
+			t.Errorf("%v: expected gauge, got %T", test.name, m.Data)
+			continue
+		}
+		if len(gauge.DataPoints) != test.points {
+			t.Errorf("%v: expected %v data points, got %v", test.name, test.points, len(gauge.DataPoints))
+		}
+		attrs := append([]attribute.KeyValue{attribute.String(inverterSNLabel, "sn-1")}, test.attrs...)
+		found := false
+		for _, dp := range gauge.DataPoints {
+			if hasAttributes(dp.Attributes, attrs) {
+				found = true
+				if !approxEqual(dp.Value, test.want) {
+					t.Errorf("%v: expected %v, got %v", test.name, test.want, dp.Value)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%v: data point with attributes %v not found", test.name, attrs)
+		}
+	}
+
+	// ratios are exported per inverter and for the whole site
+	for _, name := range []string{"foxesscloud_self_sufficiency_ratio", "foxesscloud_site_self_sufficiency_ratio"} {
+		m, ok := metrics[name]
+		if !ok {
+			t.Errorf("%v: metric not found", name)
+			continue
+		}
+		if m.Unit != "1" {
+			t.Errorf("%v: expected unit 1, got %q", name, m.Unit)
+		}
+	}
+
+	sum, ok := metrics["foxesscloud_generated_energy_lifetime_joules_total"].Data.(metricdata.Sum[float64])
+	if !ok || !sum.IsMonotonic || sum.Temporality != metricdata.CumulativeTemporality {
+		t.Errorf("expected cumulative monotonic sum, got %T", metrics["foxesscloud_generated_energy_lifetime_joules_total"].Data)
+	}
+}
+
+func hasAttributes(set attribute.Set, attrs []attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		v, ok := set.Value(kv.Key)
+		if !ok || v != kv.Value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+func apiResponseSizeDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_api_response_size_bytes_total", "Size of the API response bodies in bytes.", []string{"path"}, constLabels)
+}
+
+func apiRequestedVariablesDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_api_requested_variables", "Number of variables in the last realtime API request of the inverter.", nil, constLabels)
+}
+
+func apiUnsupportedVariablesDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_api_unsupported_variables", "Number of requested variables the inverter does not report.", nil, constLabels)
+}
+
+// requiredVariables returns the API variables needed to compute the metrics.
+func requiredVariables(metrics []metric) []foxesscloud.Variable {
+	// fault count is always needed to decide whether the fault codes are active
+	res := []foxesscloud.Variable{foxesscloud.VariableCurrentFaultCount}
+	for _, m := range metrics {
+		for _, variable := range slices.Concat(m.variables, m.optionalVariables) {
+			if !slices.Contains(res, variable) {
+				res = append(res, variable)
+			}
+		}
+	}
+	return res
+}
+
+const (
+	// number of consecutive responses missing a variable before it is considered unsupported
+	unsupportedMisses = 3
+	// unsupported variables are requested again after this interval, e.g. after a firmware update
+	unsupportedRetryInterval = time.Hour
+)
+
+// payloadStats tracks the size of the API responses and the variables the inverters do not report.
+type payloadStats struct {
+	mu     sync.Mutex
+	bytes  map[string]float64
+	misses map[string]map[foxesscloud.Variable]int
+	// unsupported holds the time the variables were last missing after they were considered unsupported
+	unsupported map[string]map[foxesscloud.Variable]time.Time
+	// requested holds the number of variables in the last request of the inverters
+	requested map[string]int
+}
+
+func newPayloadStats() *payloadStats {
+	return &payloadStats{
+		bytes:       make(map[string]float64),
+		misses:      make(map[string]map[foxesscloud.Variable]int),
+		unsupported: make(map[string]map[foxesscloud.Variable]time.Time),
+		requested:   make(map[string]int),
+	}
+}
+
+func (s *payloadStats) addBytes(path string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes[path] += float64(n)
+}
+
+func (s *payloadStats) addRequest(inverterSNs []string, variables []foxesscloud.Variable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, inverterSN := range inverterSNs {
+		s.requested[inverterSN] = len(variables)
+	}
+}
+
+// observe counts the consecutive responses missing the requested variables, variables missing in unsupportedMisses
+// responses are marked as unsupported by the inverter. It returns the newly marked variables and the unsupported
+// variables reported again.
+func (s *payloadStats) observe(inverterSN string, requested []foxesscloud.Variable, reported []foxesscloud.Variable, now time.Time) ([]foxesscloud.Variable, []foxesscloud.Variable) {
+	// an empty response says nothing about the variables, e.g. inverter is offline
+	if len(reported) == 0 {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.misses[inverterSN] == nil {
+		s.misses[inverterSN] = make(map[foxesscloud.Variable]int)
+		s.unsupported[inverterSN] = make(map[foxesscloud.Variable]time.Time)
+	}
+	misses := s.misses[inverterSN]
+	unsupported := s.unsupported[inverterSN]
+
+	var missing, recovered []foxesscloud.Variable
+	for _, variable := range requested {
+		_, wasUnsupported := unsupported[variable]
+		if slices.Contains(reported, variable) {
+			delete(misses, variable)
+			if wasUnsupported {
+				delete(unsupported, variable)
+				recovered = append(recovered, variable)
+			}
+			continue
+		}
+
+		misses[variable]++
+		if wasUnsupported || misses[variable] >= unsupportedMisses {
+			unsupported[variable] = now
+			if !wasUnsupported {
+				missing = append(missing, variable)
+			}
+		}
+	}
+	return missing, recovered
+}
+
+// supported returns the variables reported by at least one of the inverters, unsupported variables are returned again
+// once per unsupportedRetryInterval.
+func (s *payloadStats) supported(variables []foxesscloud.Variable, inverterSNs []string, now time.Time) []foxesscloud.Variable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]foxesscloud.Variable, 0, len(variables))
+	for _, variable := range variables {
+		for _, inverterSN := range inverterSNs {
+			missing, ok := s.unsupported[inverterSN][variable]
+			if !ok || now.Sub(missing) >= unsupportedRetryInterval {
+				res = append(res, variable)
+				break
+			}
+		}
+	}
+	return res
+}
+
+func (e *Exporter) collectPayload(metrics chan<- prometheus.Metric) {
+	s := e.payload
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for path, n := range s.bytes {
+		metrics <- prometheus.MustNewConstMetric(apiResponseSizeDesc(e.constLabels), prometheus.CounterValue, n, path)
+	}
+	for _, inverterSN := range e.inverters {
+		labels := e.buildLabels(inverterSN, sourceCloud)
+		if n, ok := s.requested[inverterSN]; ok {
+			metrics <- prometheus.MustNewConstMetric(apiRequestedVariablesDesc(labels), prometheus.GaugeValue, float64(n))
+		}
+		metrics <- prometheus.MustNewConstMetric(apiUnsupportedVariablesDesc(labels), prometheus.GaugeValue, float64(len(s.unsupported[inverterSN])))
+	}
+}
+
+// requestVariables returns the variables to request for the inverters, variables none of them reports are left out.
+func (e *Exporter) requestVariables(inverterSNs ...string) []foxesscloud.Variable {
+	res := e.payload.supported(e.variables, inverterSNs, time.Now())
+	if len(res) == 0 {
+		// an empty list would request all variables
+		return e.variables
+	}
+	return res
+}
+
+// checkVariables logs the requested variables the inverter stopped reporting, they are requested only periodically,
+// and the variables it reports again.
+func (e *Exporter) checkVariables(ctx context.Context, inverterSN string, requested []foxesscloud.Variable, reported []foxesscloud.Variable) {
+	missing, recovered := e.payload.observe(inverterSN, requested, reported, time.Now())
+	if len(missing) > 0 {
+		e.logger(ctx).Info("inverter does not report variables, they will be requested only periodically",
+			zap.String("inverter_sn", inverterSN),
+			zap.Any("variables", missing),
+			zap.Duration("retry_interval", unsupportedRetryInterval),
+		)
+	}
+	if len(recovered) > 0 {
+		e.logger(ctx).Info("inverter reports variables again",
+			zap.String("inverter_sn", inverterSN),
+			zap.Any("variables", recovered),
+		)
+	}
+}
+
+// Transport returns http.RoundTripper counting the size of the responses received by the next RoundTripper.
+func (e *Exporter) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &payloadTransport{stats: e.payload, next: next}
+}
+
+type payloadTransport struct {
+	stats *payloadStats
+	next  http.RoundTripper
+}
+
+func (t *payloadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, path: req.URL.Path, stats: t.stats}
+	return resp, nil
+}
+
+type countingBody struct {
+	io.ReadCloser
+	path  string
+	stats *payloadStats
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.stats.addBytes(b.path, n)
+	}
+	return n, err
+}
@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/fakeapi"
+)
+
+func TestPayloadStatsUnsupported(t *testing.T) {
+	s := newPayloadStats()
+	requested := []foxesscloud.Variable{foxesscloud.VariablePvPower, foxesscloud.VariableBoostTemperation}
+	partial := []foxesscloud.Variable{foxesscloud.VariablePvPower}
+	now := testNow
+
+	for i := range unsupportedMisses - 1 {
+		if missing, _ := s.observe("sn-1", requested, partial, now); len(missing) != 0 {
+			t.Fatalf("miss %v: expected no unsupported variables, got %v", i+1, missing)
+		}
+	}
+	// a single complete response resets the misses
+	s.observe("sn-1", requested, requested, now)
+	for range unsupportedMisses - 1 {
+		s.observe("sn-1", requested, partial, now)
+	}
+	missing, _ := s.observe("sn-1", requested, partial, now)
+	if !slices.Equal(missing, []foxesscloud.Variable{foxesscloud.VariableBoostTemperation}) {
+		t.Fatalf("expected boost temperature to be unsupported, got %v", missing)
+	}
+
+	if got := s.supported(requested, []string{"sn-1"}, now.Add(time.Minute)); !slices.Equal(got, partial) {
+		t.Errorf("expected unsupported variable not to be requested, got %v", got)
+	}
+	if got := s.supported(requested, []string{"sn-1", "sn-2"}, now.Add(time.Minute)); !slices.Equal(got, requested) {
+		t.Errorf("expected variable reported by another inverter to be requested, got %v", got)
+	}
+
+	retry := now.Add(unsupportedRetryInterval)
+	if got := s.supported(requested, []string{"sn-1"}, retry); !slices.Equal(got, requested) {
+		t.Fatalf("expected unsupported variable to be requested again, got %v", got)
+	}
+	// still missing, it is requested again after another interval
+	if missing, _ := s.observe("sn-1", requested, partial, retry); len(missing) != 0 {
+		t.Errorf("expected no newly unsupported variables, got %v", missing)
+	}
+	if got := s.supported(requested, []string{"sn-1"}, retry.Add(time.Minute)); !slices.Equal(got, partial) {
+		t.Errorf("expected unsupported variable not to be requested, got %v", got)
+	}
+
+	_, recovered := s.observe("sn-1", requested, requested, retry.Add(unsupportedRetryInterval))
+	if !slices.Equal(recovered, []foxesscloud.Variable{foxesscloud.VariableBoostTemperation}) {
+		t.Fatalf("expected boost temperature to recover, got %v", recovered)
+	}
+	if got := s.supported(requested, []string{"sn-1"}, retry.Add(unsupportedRetryInterval)); !slices.Equal(got, requested) {
+		t.Errorf("expected recovered variable to be requested, got %v", got)
+	}
+}
+
+func TestRequestedVariables(t *testing.T) {
+	for _, path := range fetchPaths {
+		t.Run(path.name, func(t *testing.T) {
+			_, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}})
+			cfg := testConfig("sn-1")
+			cfg.APIBatchSize = path.batchSize
+			var sent int
+			count := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				body, err := io.ReadAll(req.Body)
+				if err != nil {
+					return nil, err
+				}
+				var pld struct {
+					Variables []foxesscloud.Variable `json:"variables"`
+				}
+				if err := json.Unmarshal(body, &pld); err != nil {
+					return nil, err
+				}
+				sent = len(pld.Variables)
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				return http.DefaultTransport.RoundTrip(req)
+			})
+			exp := newTestExporter(t, cfg, srv.URL, testToken, count)
+
+			reg := NewRegistry(exp)
+			if _, ok := gatherValue(t, reg, "foxesscloud_api_requested_variables", map[string]string{inverterSNLabel: "sn-1"}); ok {
+				t.Error("expected no requested variables before the first request")
+			}
+			if _, err := exp.fetchInverters(context.Background(), exp.inverters); err != nil {
+				t.Fatalf("could not fetch inverters: %v", err)
+			}
+			got, ok := gatherValue(t, reg, "foxesscloud_api_requested_variables", map[string]string{inverterSNLabel: "sn-1"})
+			if !ok || sent == 0 || int(got) != sent {
+				t.Errorf("expected %v requested variables, got %v (found %v)", sent, got, ok)
+			}
+		})
+	}
+}
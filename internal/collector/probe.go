@@ -0,0 +1,220 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/openapi"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+type account struct {
+	api *openapi.Client
+}
+
+// AddAccount registers API client of a named account, which can be used to probe its inverters.
+func (e *Exporter) AddAccount(name string, api *openapi.Client) {
+	e.accounts[name] = account{api: api}
+}
+
+const (
+	// probed inverters not probed for this many fetch intervals are evicted from the cache
+	probeTTLIntervals = 10
+	// maximum number of probed inverters kept in the cache
+	maxProbeEntries = 1000
+)
+
+type probeKey struct {
+	account    string
+	inverterSN string
+}
+
+// energyKey is the key of the energy state of the probed inverter, the same inverter probed with different accounts
+// and the inverters fetched in the background keep separate counters.
+func (k probeKey) energyKey() string {
+	return "probe/" + k.account + "/" + k.inverterSN
+}
+
+type probeEntry struct {
+	data    metricData
+	err     error
+	fetched time.Time
+	call    *fetchCall
+}
+
+type probeCache struct {
+	minAge     time.Duration
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[probeKey]*probeEntry
+}
+
+func newProbeCache(minAge time.Duration, ttl time.Duration, maxEntries int) *probeCache {
+	return &probeCache{
+		minAge:     minAge,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[probeKey]*probeEntry),
+	}
+}
+
+// evict removes the entries not fetched within the TTL and the least recently fetched entries above the maximum size,
+// entries being fetched are kept. It returns the evicted keys and has to be called with the lock held.
+func (c *probeCache) evict(now time.Time) []probeKey {
+	var res []probeKey
+	for key, entry := range c.entries {
+		if entry.call == nil && now.Sub(entry.fetched) > c.ttl {
+			delete(c.entries, key)
+			res = append(res, key)
+		}
+	}
+	for len(c.entries) > c.maxEntries {
+		var oldest probeKey
+		var oldestEntry *probeEntry
+		for key, entry := range c.entries {
+			if entry.call == nil && (oldestEntry == nil || entry.fetched.Before(oldestEntry.fetched)) {
+				oldest, oldestEntry = key, entry
+			}
+		}
+		if oldestEntry == nil {
+			break
+		}
+		delete(c.entries, oldest)
+		res = append(res, oldest)
+	}
+	return res
+}
+
+func probeSuccessDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_probe_success", "Whether the probe of the inverter succeeded.", nil, constLabels)
+}
+
+func probeDurationDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_probe_duration_seconds", "How long the probe of the inverter took in seconds.", nil, constLabels)
+}
+
+// Probe returns a collector exporting the metrics of a single inverter. Inverters fetched in the background
+// are served from the exporter data, other inverters are fetched on demand and cached for the minimum fetch age.
+func (e *Exporter) Probe(ctx context.Context, accountName string, inverterSN string) (prometheus.Collector, error) {
+	if accountName == "" {
+		accountName = config.DefaultAccount
+	}
+	acc, ok := e.accounts[accountName]
+	if !ok {
+		return nil, fmt.Errorf("unknown account: %v", accountName)
+	}
+
+	start := time.Now()
+	data, err := e.probe(ctx, accountName, acc, inverterSN)
+	if err != nil {
+		e.logger(ctx).Error("could not probe inverter",
+			zap.String("account", accountName),
+			zap.String("inverter_sn", inverterSN),
+			zap.Error(err),
+		)
+	}
+	return &probeCollector{
+		e:        e,
+		data:     data,
+		success:  err == nil,
+		duration: time.Since(start),
+	}, nil
+}
+
+func (e *Exporter) probe(ctx context.Context, accountName string, acc account, inverterSN string) (metricData, error) {
+	if accountName == config.DefaultAccount && slices.Contains(e.inverters, inverterSN) {
+		e.Refresh(ctx)
+		if d, ok := e.latestData(inverterSN); ok {
+			return d, nil
+		}
+		return metricData{}, fmt.Errorf("no data")
+	}
+
+	c := e.probes
+	key := probeKey{account: accountName, inverterSN: inverterSN}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &probeEntry{}
+		c.entries[key] = entry
+	}
+	call := entry.call
+	if call == nil {
+		if !entry.fetched.IsZero() && time.Since(entry.fetched) < c.minAge {
+			c.mu.Unlock()
+			return entry.data, entry.err
+		}
+		call = &fetchCall{done: make(chan struct{})}
+		entry.call = call
+		go e.fetchProbe(key, acc, entry)
+	}
+	evicted := c.evict(time.Now())
+	c.mu.Unlock()
+
+	if len(evicted) > 0 {
+		e.energyMu.Lock()
+		for _, k := range evicted {
+			delete(e.energy, k.energyKey())
+		}
+		e.energyMu.Unlock()
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return metricData{}, ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return entry.data, entry.err
+}
+
+func (e *Exporter) fetchProbe(key probeKey, acc account, entry *probeEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.cycleTimeout)
+	defer cancel()
+
+	data, err := e.fetchInverter(ctx, acc, key.inverterSN)
+	if err == nil {
+		e.energyMu.Lock()
+		e.updateInverterEnergy(key.energyKey(), &data)
+		e.energyMu.Unlock()
+		e.faultHistory.record(data.InverterSN, data.Faults, data.UpdateTime)
+	}
+
+	e.probes.mu.Lock()
+	entry.data = data
+	entry.err = err
+	entry.fetched = time.Now()
+	call := entry.call
+	entry.call = nil
+	e.probes.mu.Unlock()
+	close(call.done)
+}
+
+type probeCollector struct {
+	e        *Exporter
+	data     metricData
+	success  bool
+	duration time.Duration
+}
+
+func (c *probeCollector) Describe(descs chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, descs)
+}
+
+func (c *probeCollector) Collect(metrics chan<- prometheus.Metric) {
+	metrics <- prometheus.MustNewConstMetric(probeSuccessDesc(c.e.constLabels), prometheus.GaugeValue, boolToFloat(c.success))
+	metrics <- prometheus.MustNewConstMetric(probeDurationDesc(c.e.constLabels), prometheus.GaugeValue, c.duration.Seconds())
+	if c.success {
+		c.e.collectData(metrics, []metricData{c.data})
+	}
+}
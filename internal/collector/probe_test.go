@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/fakeapi"
+	"github.com/jbub/foxesscloud_exporter/internal/openapi"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestProbeCacheEvict(t *testing.T) {
+	now := time.Now()
+	c := newProbeCache(time.Minute, time.Hour, 2)
+	c.entries[probeKey{inverterSN: "expired"}] = &probeEntry{fetched: now.Add(-time.Hour * 2)}
+	c.entries[probeKey{inverterSN: "fetching"}] = &probeEntry{call: &fetchCall{done: make(chan struct{})}}
+	c.entries[probeKey{inverterSN: "old"}] = &probeEntry{fetched: now.Add(-time.Minute * 30)}
+	c.entries[probeKey{inverterSN: "new"}] = &probeEntry{fetched: now.Add(-time.Minute)}
+
+	evicted := c.evict(now)
+	if len(evicted) != 2 {
+		t.Fatalf("expected 2 evicted entries, got %v", evicted)
+	}
+	for _, sn := range []string{"fetching", "new"} {
+		if _, ok := c.entries[probeKey{inverterSN: sn}]; !ok {
+			t.Errorf("expected %v entry to be kept", sn)
+		}
+	}
+}
+
+func TestProbeEnergyPerAccount(t *testing.T) {
+	_, srv := newTestAPI(t, fakeapi.Config{Inverters: []string{"sn-1", "sn-2"}})
+	exp := newTestExporter(t, testConfig("sn-1"), srv.URL, testToken, nil)
+	exp.AddAccount("other", openapi.NewClient(openapi.Config{BaseURL: srv.URL, Token: testToken}))
+
+	for _, accountName := range []string{config.DefaultAccount, "other"} {
+		if _, err := exp.probe(context.Background(), accountName, exp.accounts[accountName], "sn-2"); err != nil {
+			t.Fatalf("could not probe inverter: %v", err)
+		}
+	}
+
+	for _, accountName := range []string{config.DefaultAccount, "other"} {
+		key := probeKey{account: accountName, inverterSN: "sn-2"}.energyKey()
+		if _, ok := exp.energy[key]; !ok {
+			t.Errorf("expected energy state %v", key)
+		}
+	}
+	if _, ok := exp.energy["sn-2"]; ok {
+		t.Error("expected probe energy state not to be keyed by the serial number")
+	}
+}
+
+func TestProbeSiteRatios(t *testing.T) {
+	_, srv := newTestAPI(t, fakeapi.Config{Inverters: []string{"sn-1"}})
+	exp := newTestExporter(t, testConfig("sn-1"), srv.URL, testToken, nil)
+	data, err := exp.fetchInverters(context.Background(), exp.inverters)
+	if err != nil {
+		t.Fatalf("could not fetch inverters: %v", err)
+	}
+	exp.storeData(data)
+
+	collector, err := exp.Probe(context.Background(), "", "sn-1")
+	if err != nil {
+		t.Fatalf("could not probe inverter: %v", err)
+	}
+	probeReg := prometheus.NewRegistry()
+	probeReg.MustRegister(collector)
+	for name, reg := range map[string]prometheus.Gatherer{"exporter": NewRegistry(exp), "probe": probeReg} {
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatalf("%v: could not gather metrics: %v", name, err)
+		}
+		var site, inverter bool
+		for _, mf := range mfs {
+			site = site || strings.HasPrefix(mf.GetName(), "foxesscloud_site_")
+			inverter = inverter || mf.GetName() == "foxesscloud_self_sufficiency_ratio"
+		}
+		if !inverter {
+			t.Errorf("%v: expected inverter ratios", name)
+		}
+		if wantSite := name == "exporter"; site != wantSite {
+			t.Errorf("%v: expected site ratios %v, got %v", name, wantSite, site)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jbub/foxesscloud"
+)
+
+const (
+	// maxPVStrings is the number of PV strings known to the API
+	maxPVStrings = 18
+	// legacyPVStrings is the number of PV strings exposed by the legacy metrics
+	legacyPVStrings = 4
+
+	pvStringVoltage = "Volt"
+	pvStringCurrent = "Current"
+	pvStringPower   = "Power"
+)
+
+type pvString struct {
+	Voltage float64
+	Current float64
+	Power   float64
+}
+
+func pvStringVariable(n int, quantity string) foxesscloud.Variable {
+	return foxesscloud.Variable(fmt.Sprintf("pv%d%s", n, quantity))
+}
+
+// parsePVStringVariable parses the string number and quantity from variables like pv12Volt.
+func parsePVStringVariable(variable foxesscloud.Variable) (int, string, bool) {
+	rest, ok := strings.CutPrefix(string(variable), "pv")
+	if !ok {
+		return 0, "", false
+	}
+	for _, quantity := range []string{pvStringVoltage, pvStringCurrent, pvStringPower} {
+		num, ok := strings.CutSuffix(rest, quantity)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil || n < 1 || n > maxPVStrings {
+			return 0, "", false
+		}
+		return n, quantity, true
+	}
+	return 0, "", false
+}
+
+func (d *metricData) setPVString(n int, quantity string, value float64) {
+	if d.PVStrings == nil {
+		d.PVStrings = make(map[int]pvString)
+	}
+	s := d.PVStrings[n]
+	switch quantity {
+	case pvStringVoltage:
+		s.Voltage = value
+	case pvStringCurrent:
+		s.Current = value
+	case pvStringPower:
+		s.Power = value
+	}
+	d.PVStrings[n] = s
+}
@@ -0,0 +1,176 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// powerFlows holds the power in kW or the energy in kWh flowing through the site.
+type powerFlows struct {
+	photovoltaic    float64
+	feedIn          float64
+	load            float64
+	gridConsumption float64
+}
+
+func (f powerFlows) add(other powerFlows) powerFlows {
+	return powerFlows{
+		photovoltaic:    f.photovoltaic + other.photovoltaic,
+		feedIn:          f.feedIn + other.feedIn,
+		load:            f.load + other.load,
+		gridConsumption: f.gridConsumption + other.gridConsumption,
+	}
+}
+
+// flowVariables are the variables needed to compute the ratios.
+var flowVariables = []foxesscloud.Variable{
+	foxesscloud.VariablePvPower,
+	foxesscloud.VariableFeedinPower,
+	foxesscloud.VariableLoadsPower,
+	foxesscloud.VariableGridConsumptionPower,
+}
+
+// currentFlows returns the power flows of the reading.
+func currentFlows(data metricData) powerFlows {
+	return powerFlows{
+		photovoltaic:    data.PhotovoltaicPower,
+		feedIn:          data.FeedInPower,
+		load:            data.LoadPower,
+		gridConsumption: data.GridConsumptionPower,
+	}
+}
+
+// todayFlows returns the energy flows since the start of the day.
+func todayFlows(data metricData) powerFlows {
+	return powerFlows{
+		photovoltaic:    data.TodayEnergy["photovoltaic"],
+		feedIn:          data.TodayEnergy["feed_in"],
+		load:            data.TodayEnergy["load"],
+		gridConsumption: data.TodayEnergy["grid_consumption"],
+	}
+}
+
+func hasFlows(data metricData) bool {
+	if data.Variables == nil {
+		return true
+	}
+	for _, variable := range flowVariables {
+		if !data.Variables[variable] {
+			return false
+		}
+	}
+	return true
+}
+
+// flowRatio is a ratio of the power flows, it is not defined when the denominator is not positive,
+// e.g. self-consumption at night when there is no photovoltaic power.
+type flowRatio struct {
+	name  string
+	help  string
+	ratio func(f powerFlows) (float64, bool)
+}
+
+func flowRatios() []flowRatio {
+	return []flowRatio{
+		{
+			name: "self_consumption",
+			help: "Share of the photovoltaic power consumed on site instead of fed into the grid.",
+			ratio: func(f powerFlows) (float64, bool) {
+				return safeRatio(f.photovoltaic-f.feedIn, f.photovoltaic)
+			},
+		},
+		{
+			name: "self_sufficiency",
+			help: "Share of the load covered without the grid, also known as autarky.",
+			ratio: func(f powerFlows) (float64, bool) {
+				return safeRatio(f.load-f.gridConsumption, f.load)
+			},
+		},
+		{
+			name: "grid_dependency",
+			help: "Share of the load covered by the grid.",
+			ratio: func(f powerFlows) (float64, bool) {
+				return safeRatio(f.gridConsumption, f.load)
+			},
+		},
+	}
+}
+
+// safeRatio returns the ratio clamped to [0, 1], the clamping covers flows from and to a battery.
+func safeRatio(numerator, denominator float64) (float64, bool) {
+	if denominator <= 0 {
+		return 0, false
+	}
+	return min(max(numerator/denominator, 0), 1), true
+}
+
+func (r flowRatio) desc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_"+r.name+"_ratio", r.help, nil, constLabels)
+}
+
+func (r flowRatio) todayDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_"+r.name+"_today_ratio", r.help+" Computed from the energy since the start of the day.", nil, constLabels)
+}
+
+func (r flowRatio) siteDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_site_"+r.name+"_ratio", r.help+" Computed for all inverters together.", nil, constLabels)
+}
+
+func (r flowRatio) siteTodayDesc(constLabels prometheus.Labels) *prometheus.Desc {
+	return prometheus.NewDesc("foxesscloud_site_"+r.name+"_today_ratio", r.help+" Computed for all inverters together from the energy since the start of the day.", nil, constLabels)
+}
+
+func (e *Exporter) describeRatios(descs chan<- *prometheus.Desc, labels prometheus.Labels) {
+	for _, r := range e.ratios {
+		descs <- r.desc(labels)
+		descs <- r.todayDesc(labels)
+	}
+}
+
+func (e *Exporter) describeSiteRatios(descs chan<- *prometheus.Desc) {
+	for _, r := range e.ratios {
+		descs <- r.siteDesc(e.constLabels)
+		descs <- r.siteTodayDesc(e.constLabels)
+	}
+}
+
+// collectRatios exports the ratios per inverter.
+func (e *Exporter) collectRatios(metrics chan<- prometheus.Metric, data []metricData, exposed []bool, timestamps []time.Time) {
+	for i, d := range data {
+		if !hasFlows(d) || !exposed[i] {
+			continue
+		}
+		labels := e.buildLabels(d.InverterSN, d.Source)
+		for _, r := range e.ratios {
+			if v, ok := r.ratio(currentFlows(d)); ok {
+				metrics <- withTimestamp(prometheus.MustNewConstMetric(r.desc(labels), prometheus.GaugeValue, v), timestamps[i])
+			}
+			if v, ok := r.ratio(todayFlows(d)); ok {
+				metrics <- withTimestamp(prometheus.MustNewConstMetric(r.todayDesc(labels), prometheus.GaugeValue, v), timestamps[i])
+			}
+		}
+	}
+}
+
+// collectSiteRatios exports the ratios of all inverters together, readings not exposed because of their timestamps
+// are still part of them.
+func (e *Exporter) collectSiteRatios(metrics chan<- prometheus.Metric, data []metricData) {
+	var site, siteToday powerFlows
+	for _, d := range data {
+		if hasFlows(d) {
+			site = site.add(currentFlows(d))
+			siteToday = siteToday.add(todayFlows(d))
+		}
+	}
+
+	for _, r := range e.ratios {
+		if v, ok := r.ratio(site); ok {
+			metrics <- prometheus.MustNewConstMetric(r.siteDesc(e.constLabels), prometheus.GaugeValue, v)
+		}
+		if v, ok := r.ratio(siteToday); ok {
+			metrics <- prometheus.MustNewConstMetric(r.siteTodayDesc(e.constLabels), prometheus.GaugeValue, v)
+		}
+	}
+}
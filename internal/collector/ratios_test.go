@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/jbub/foxesscloud"
+	"go.uber.org/zap"
+)
+
+func TestSafeRatio(t *testing.T) {
+	tests := []struct {
+		numerator   float64
+		denominator float64
+		want        float64
+		ok          bool
+	}{
+		{numerator: 1, denominator: 2, want: 0.5, ok: true},
+		{numerator: 2, denominator: 2, want: 1, ok: true},
+		// a discharging battery pushes the ratios out of range
+		{numerator: 3, denominator: 2, want: 1, ok: true},
+		{numerator: -1, denominator: 2, want: 0, ok: true},
+		{numerator: 1, denominator: 0},
+		{numerator: 1, denominator: -1},
+	}
+	for _, test := range tests {
+		got, ok := safeRatio(test.numerator, test.denominator)
+		if ok != test.ok || !approxEqual(got, test.want) {
+			t.Errorf("%v/%v: expected %v (ok %v), got %v (ok %v)", test.numerator, test.denominator, test.want, test.ok, got, ok)
+		}
+	}
+}
+
+func TestCollectRatios(t *testing.T) {
+	reading := func(inverterSN string, flows powerFlows, today map[string]float64, variables ...foxesscloud.Variable) metricData {
+		d := metricData{InverterSN: inverterSN, Source: sourceCloud, UpdateTime: testNow, TodayEnergy: today}
+		values := map[foxesscloud.Variable]float64{
+			foxesscloud.VariablePvPower:              flows.photovoltaic,
+			foxesscloud.VariableFeedinPower:          flows.feedIn,
+			foxesscloud.VariableLoadsPower:           flows.load,
+			foxesscloud.VariableGridConsumptionPower: flows.gridConsumption,
+		}
+		for _, variable := range variables {
+			d.setVariable(variable, values[variable])
+		}
+		return d
+	}
+	today := map[string]float64{"photovoltaic": 10, "feed_in": 4, "load": 8, "grid_consumption": 2}
+	data := []metricData{
+		reading("sn-1", powerFlows{photovoltaic: 4, feedIn: 1, load: 3}, today, flowVariables...),
+		// night without photovoltaic power
+		reading("sn-2", powerFlows{load: 2, gridConsumption: 2}, nil, flowVariables...),
+		// readings missing a flow are left out, also from the site ratios
+		reading("sn-3", powerFlows{photovoltaic: 5, load: 5}, nil, foxesscloud.VariablePvPower, foxesscloud.VariableLoadsPower),
+	}
+
+	exp, err := New(testConfig("sn-1", "sn-2", "sn-3"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("could not create exporter: %v", err)
+	}
+	exp.data.Store(&data)
+	reg := NewRegistry(exp)
+
+	tests := []struct {
+		name       string
+		inverterSN string
+		want       float64
+		ok         bool
+	}{
+		{name: "foxesscloud_self_consumption_ratio", inverterSN: "sn-1", want: 0.75, ok: true},
+		{name: "foxesscloud_self_sufficiency_ratio", inverterSN: "sn-1", want: 1, ok: true},
+		{name: "foxesscloud_grid_dependency_ratio", inverterSN: "sn-1", want: 0, ok: true},
+		{name: "foxesscloud_self_consumption_today_ratio", inverterSN: "sn-1", want: 0.6, ok: true},
+		{name: "foxesscloud_self_sufficiency_today_ratio", inverterSN: "sn-1", want: 0.75, ok: true},
+		{name: "foxesscloud_self_consumption_ratio", inverterSN: "sn-2"},
+		{name: "foxesscloud_self_sufficiency_ratio", inverterSN: "sn-2", want: 0, ok: true},
+		{name: "foxesscloud_grid_dependency_ratio", inverterSN: "sn-2", want: 1, ok: true},
+		{name: "foxesscloud_self_consumption_today_ratio", inverterSN: "sn-2"},
+		{name: "foxesscloud_self_sufficiency_ratio", inverterSN: "sn-3"},
+		{name: "foxesscloud_site_self_consumption_ratio", want: 0.75, ok: true},
+		{name: "foxesscloud_site_self_sufficiency_ratio", want: 0.6, ok: true},
+		{name: "foxesscloud_site_grid_dependency_ratio", want: 0.4, ok: true},
+		{name: "foxesscloud_site_self_consumption_today_ratio", want: 0.6, ok: true},
+	}
+	for _, test := range tests {
+		labels := map[string]string{}
+		if test.inverterSN != "" {
+			labels[inverterSNLabel] = test.inverterSN
+		}
+		got, ok := gatherValue(t, reg, test.name, labels)
+		if ok != test.ok || !approxEqual(got, test.want) {
+			t.Errorf("%v %v: expected %v (found %v), got %v (found %v)", test.name, test.inverterSN, test.want, test.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/openapi"
+	"github.com/jbub/foxesscloud_exporter/internal/recorder"
+	"go.uber.org/zap"
+)
+
+type replayRequest struct {
+	InverterSN string                 `json:"sn"`
+	Variables  []foxesscloud.Variable `json:"variables"`
+}
+
+type replayResponse[T any] struct {
+	ErrNo  int `json:"errno"`
+	Result []T `json:"result"`
+}
+
+// Replay feeds the realtime responses recorded in dir through the exporter as if they were fetched.
+// The time between recorded responses is divided by speed, zero speed replays as fast as possible.
+func (e *Exporter) Replay(ctx context.Context, dir string, speed float64) error {
+	var (
+		prev      time.Time
+		inverters []string
+		latest    = make(map[string]metricData)
+	)
+
+	return recorder.Read(dir, func(entry recorder.Entry) error {
+		if entry.Path != openapi.RealtimePath && entry.Path != openapi.RealtimeBatchPath {
+			return nil
+		}
+
+		if speed > 0 && !prev.IsZero() && entry.Time.After(prev) {
+			timer := time.NewTimer(time.Duration(float64(entry.Time.Sub(prev)) / speed))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		prev = entry.Time
+
+		items, err := replayEntry(entry, latest, e.units)
+		if err != nil {
+			e.log.Warn("could not replay entry", zap.Time("time", entry.Time), zap.Error(err))
+			return nil
+		}
+		if len(items) == 0 {
+			return nil
+		}
+
+		for _, d := range items {
+			if !slices.Contains(inverters, d.InverterSN) {
+				inverters = append(inverters, d.InverterSN)
+			}
+			latest[d.InverterSN] = d
+		}
+
+		data := make([]metricData, 0, len(inverters))
+		for _, inverterSN := range inverters {
+			data = append(data, latest[inverterSN])
+		}
+		e.storeData(data)
+		return nil
+	})
+}
+
+func replayEntry(entry recorder.Entry, latest map[string]metricData, units *unitNormaliser) ([]metricData, error) {
+	if entry.Path == openapi.RealtimeBatchPath {
+		return replayBatchEntry(entry, latest, units)
+	}
+
+	var req replayRequest
+	if err := json.Unmarshal(entry.Request, &req); err != nil {
+		return nil, fmt.Errorf("could not unmarshal request: %w", err)
+	}
+
+	// recordings of older versions contain separate fault queries, they only update faults of the last reading
+	if len(req.Variables) == 1 && req.Variables[0] == foxesscloud.VariableCurrentFault {
+		var resp replayResponse[openapi.RealtimeData]
+		if err := json.Unmarshal(entry.Response, &resp); err != nil {
+			return nil, fmt.Errorf("could not unmarshal response: %w", err)
+		}
+		d, ok := latest[req.InverterSN]
+		if resp.ErrNo != 0 || !ok {
+			return nil, nil
+		}
+		d.Faults = nil
+		for _, item := range resp.Result {
+			for _, dataItem := range item.Datas {
+				if dataItem.Variable == foxesscloud.VariableCurrentFault {
+					d.Faults = append(d.Faults, parseFaults(dataItem.String())...)
+				}
+			}
+		}
+		return []metricData{d}, nil
+	}
+
+	var resp replayResponse[openapi.RealtimeData]
+	if err := json.Unmarshal(entry.Response, &resp); err != nil {
+		return nil, fmt.Errorf("could not unmarshal response: %w", err)
+	}
+	if resp.ErrNo != 0 || len(resp.Result) == 0 {
+		return nil, nil
+	}
+
+	d := newMetricDataFromAPI(req.InverterSN, resp.Result[0], units)
+	if d.FaultCount > 0 && !hasVariable(resp.Result[0], foxesscloud.VariableCurrentFault) {
+		d.Faults = latest[req.InverterSN].Faults
+	}
+	return []metricData{d}, nil
+}
+
+func replayBatchEntry(entry recorder.Entry, latest map[string]metricData, units *unitNormaliser) ([]metricData, error) {
+	var resp replayResponse[openapi.RealtimeData]
+	if err := json.Unmarshal(entry.Response, &resp); err != nil {
+		return nil, fmt.Errorf("could not unmarshal response: %w", err)
+	}
+	if resp.ErrNo != 0 {
+		return nil, nil
+	}
+
+	res := make([]metricData, 0, len(resp.Result))
+	for _, item := range resp.Result {
+		d := newMetricDataFromAPI(item.DeviceSN, item, units)
+		if d.FaultCount > 0 && !hasVariable(item, foxesscloud.VariableCurrentFault) {
+			d.Faults = latest[item.DeviceSN].Faults
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/jbub/foxesscloud_exporter/internal/openapi"
+	"github.com/jbub/foxesscloud_exporter/internal/recorder"
+	"go.uber.org/zap"
+)
+
+func TestReplayEntry(t *testing.T) {
+	latest := map[string]metricData{
+		"sn-1": {InverterSN: "sn-1", PhotovoltaicPower: 1, Faults: []fault{lookupFault("17")}},
+	}
+	type reading struct {
+		inverterSN string
+		power      float64
+		faults     []string
+	}
+	tests := []struct {
+		name     string
+		path     string
+		request  string
+		response string
+		want     []reading
+	}{
+		{
+			name:     "realtime",
+			path:     openapi.RealtimePath,
+			request:  `{"sn":"sn-1","variables":["pvPower","currentFault"]}`,
+			response: `{"errno":0,"result":[{"deviceSN":"sn-1","time":"2024-06-21 14:07:00 CEST+0200","datas":[{"variable":"pvPower","unit":"kW","value":2.5},{"variable":"currentFault","value":"12"}]}]}`,
+			want:     []reading{{inverterSN: "sn-1", power: 2.5, faults: []string{"12"}}},
+		},
+		{
+			// the fault codes missing in the response are taken from the last reading
+			name:     "realtime without fault codes",
+			path:     openapi.RealtimePath,
+			request:  `{"sn":"sn-1","variables":["pvPower","currentFaultCount"]}`,
+			response: `{"errno":0,"result":[{"deviceSN":"sn-1","time":"2024-06-21 14:07:00 CEST+0200","datas":[{"variable":"pvPower","unit":"W","value":2500},{"variable":"currentFaultCount","value":1}]}]}`,
+			want:     []reading{{inverterSN: "sn-1", power: 2.5, faults: []string{"17"}}},
+		},
+		{
+			name:     "batch",
+			path:     openapi.RealtimeBatchPath,
+			request:  `{"sns":["sn-1","sn-2"],"variables":["pvPower"]}`,
+			response: `{"errno":0,"result":[{"deviceSN":"sn-1","time":"2024-06-21 14:07:00 CEST+0200","datas":[{"variable":"pvPower","unit":"kW","value":2.5}]},{"deviceSN":"sn-2","time":"2024-06-21 14:07:00 CEST+0200","datas":[{"variable":"pvPower","unit":"kW","value":1.5}]}]}`,
+			want:     []reading{{inverterSN: "sn-1", power: 2.5}, {inverterSN: "sn-2", power: 1.5}},
+		},
+		{
+			// older versions fetched the fault codes separately, they update the last reading
+			name:     "fault query",
+			path:     openapi.RealtimePath,
+			request:  `{"sn":"sn-1","variables":["currentFault"]}`,
+			response: `{"errno":0,"result":[{"deviceSN":"sn-1","time":"2024-06-21 14:07:00 CEST+0200","datas":[{"variable":"currentFault","value":"1,12"}]}]}`,
+			want:     []reading{{inverterSN: "sn-1", power: 1, faults: []string{"1", "12"}}},
+		},
+		{
+			name:     "error response",
+			path:     openapi.RealtimePath,
+			request:  `{"sn":"sn-1","variables":["pvPower"]}`,
+			response: `{"errno":40402,"msg":"rate limit exceeded"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := recorder.Entry{
+				Time:     testNow,
+				Path:     test.path,
+				Request:  []byte(test.request),
+				Response: []byte(test.response),
+			}
+			data, err := replayEntry(entry, latest, newUnitNormaliser(zap.NewNop()))
+			if err != nil {
+				t.Fatalf("could not replay entry: %v", err)
+			}
+			if len(data) != len(test.want) {
+				t.Fatalf("expected %v readings, got %v", len(test.want), len(data))
+			}
+			for i, want := range test.want {
+				d := data[i]
+				var faults []string
+				for _, f := range d.Faults {
+					faults = append(faults, f.Code)
+				}
+				if d.InverterSN != want.inverterSN || !approxEqual(d.PhotovoltaicPower, want.power) || !slices.Equal(faults, want.faults) {
+					t.Errorf("expected %+v, got inverter %v, power %v and faults %v", want, d.InverterSN, d.PhotovoltaicPower, faults)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"slices"
+	"time"
+
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+)
+
+// fetchSchedule decides when the inverters are fetched. When the site location is known, inverters are fetched
+// less often outside daylight, except for the inverters polled at night. When aligned, fetches are delayed until
+// the next upstream refresh of the inverter data is expected.
+type fetchSchedule struct {
+	cadence       *cadenceTracker
+	align         bool
+	inverters     []string
+	interval      time.Duration
+	nightInterval time.Duration
+	ramp          time.Duration
+	located       bool
+	latitude      float64
+	longitude     float64
+	nightPolling  []string
+	next          map[string]time.Time
+}
+
+func newFetchSchedule(cfg config.Config, cadence *cadenceTracker) *fetchSchedule {
+	return &fetchSchedule{
+		cadence:       cadence,
+		align:         cfg.APIFetchAlign,
+		inverters:     cfg.Inverters,
+		interval:      cfg.APIFetchInterval,
+		nightInterval: cfg.APIFetchNightInterval,
+		ramp:          cfg.APIFetchRamp,
+		located:       cfg.SiteLocated,
+		latitude:      cfg.SiteLatitude,
+		longitude:     cfg.SiteLongitude,
+		nightPolling:  cfg.APIFetchNightInverters,
+		next:          make(map[string]time.Time, len(cfg.Inverters)),
+	}
+}
+
+// intervalAt returns the fetch interval of the inverter at t. Before sunrise and after sunset the interval
+// changes linearly from the day interval to the night interval over the ramp.
+func (s *fetchSchedule) intervalAt(inverterSN string, t time.Time) time.Duration {
+	if !s.located || slices.Contains(s.nightPolling, inverterSN) {
+		return s.interval
+	}
+
+	dark := darkness(t, s.latitude, s.longitude)
+	switch {
+	case dark == 0:
+		return s.interval
+	case dark >= s.ramp:
+		return s.nightInterval
+	}
+	return s.interval + time.Duration(float64(s.nightInterval-s.interval)*float64(dark)/float64(s.ramp))
+}
+
+// due returns the inverters whose fetch is due at now.
+func (s *fetchSchedule) due(now time.Time) []string {
+	var res []string
+	for _, inverterSN := range s.inverters {
+		if !now.Before(s.next[inverterSN]) {
+			res = append(res, inverterSN)
+		}
+	}
+	return res
+}
+
+// fetched schedules the next fetch of the inverters fetched at now.
+func (s *fetchSchedule) fetched(inverters []string, now time.Time) {
+	for _, inverterSN := range inverters {
+		next := now.Add(s.intervalAt(inverterSN, now))
+		if expected, ok := s.cadence.expectedUpdate(inverterSN); ok && s.align && expected.After(next) {
+			next = expected
+		}
+		s.next[inverterSN] = next
+	}
+}
+
+// nextFetch returns the time of the earliest scheduled fetch.
+func (s *fetchSchedule) nextFetch() time.Time {
+	var res time.Time
+	for _, inverterSN := range s.inverters {
+		if next := s.next[inverterSN]; res.IsZero() || next.Before(res) {
+			res = next
+		}
+	}
+	return res
+}
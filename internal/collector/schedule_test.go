@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestFetchScheduleLocation(t *testing.T) {
+	midnight := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		located bool
+		want    time.Duration
+	}{
+		{name: "not located", located: false, want: time.Minute},
+		// zero coordinates are a valid location on the equator and prime meridian
+		{name: "located at zero coordinates", located: true, want: time.Minute * 15},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testConfig("sn-1")
+			cfg.APIFetchNightInterval = time.Minute * 15
+			cfg.APIFetchRamp = time.Hour
+			cfg.SiteLocated = test.located
+			s := newFetchSchedule(cfg, newCadenceTracker())
+
+			if got := s.intervalAt("sn-1", midnight); got != test.want {
+				t.Errorf("expected interval %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestNewSiteLocation(t *testing.T) {
+	tests := []struct {
+		name      string
+		latitude  float64
+		longitude float64
+		valid     bool
+	}{
+		{name: "valid", latitude: 48.15, longitude: 17.11, valid: true},
+		{name: "bounds", latitude: -90, longitude: 180, valid: true},
+		{name: "latitude out of range", latitude: 90.5, longitude: 17.11},
+		{name: "longitude out of range", latitude: 48.15, longitude: -180.5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testConfig("sn-1")
+			cfg.SiteLocated = true
+			cfg.SiteLatitude = test.latitude
+			cfg.SiteLongitude = test.longitude
+
+			_, err := New(cfg, zap.NewNop())
+			if test.valid && err != nil {
+				t.Errorf("expected valid location, got %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("expected invalid location error")
+			}
+		})
+	}
+}
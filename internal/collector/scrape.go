@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fetchCall is a fetch shared by all concurrent scrapes.
+type fetchCall struct {
+	done chan struct{}
+}
+
+type scrapeFetcher struct {
+	minAge time.Duration
+
+	mu        sync.Mutex
+	call      *fetchCall
+	lastFetch time.Time
+}
+
+// Refresh fetches the inverter data when the last fetch is older than the minimum age, concurrent callers
+// share a single in-flight fetch. The fetch is not bound to ctx, so that a scrape giving up early does not
+// waste the request, the caller only stops waiting and gets the cached data.
+func (e *Exporter) Refresh(ctx context.Context) {
+	f := e.scrape
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	call := f.call
+	if call == nil {
+		if time.Since(f.lastFetch) < f.minAge {
+			f.mu.Unlock()
+			return
+		}
+		call = &fetchCall{done: make(chan struct{})}
+		f.call = call
+		f.lastFetch = time.Now()
+		go e.refresh(call)
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		e.log.Debug("scrape timeout exceeded waiting for fetch, using cached data", zap.Error(ctx.Err()))
+	}
+}
+
+func (e *Exporter) refresh(call *fetchCall) {
+	defer func() {
+		e.scrape.mu.Lock()
+		e.scrape.call = nil
+		e.scrape.mu.Unlock()
+		close(call.done)
+	}()
+
+	data, err := e.fetchInverters(context.Background(), e.inverters)
+	if err != nil {
+		e.log.Error("could not fetch inverter data", zap.Error(err))
+		return
+	}
+	e.storeData(data)
+}
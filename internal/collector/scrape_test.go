@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/fakeapi"
+)
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		minAge     time.Duration
+		concurrent bool
+		want       int64
+	}{
+		{name: "interval mode", mode: config.FetchModeInterval, want: 0},
+		{name: "min age", mode: config.FetchModeScrape, minAge: time.Hour, want: 1},
+		{name: "no min age", mode: config.FetchModeScrape, want: 3},
+		{name: "concurrent scrapes", mode: config.FetchModeScrape, concurrent: true, want: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}})
+			cfg := testConfig("sn-1")
+			cfg.APIFetchMode = test.mode
+			cfg.APIFetchMinAge = test.minAge
+
+			var requests atomic.Int64
+			release := make(chan struct{})
+			count := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				requests.Add(1)
+				if test.concurrent {
+					<-release
+				}
+				return http.DefaultTransport.RoundTrip(req)
+			})
+			exp := newTestExporter(t, cfg, srv.URL, testToken, count)
+
+			var wg sync.WaitGroup
+			for range 3 {
+				if !test.concurrent {
+					exp.Refresh(context.Background())
+					continue
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					exp.Refresh(context.Background())
+				}()
+			}
+			if test.concurrent {
+				// the scrapes wait for the fetch started by the first of them
+				time.Sleep(time.Millisecond * 50)
+				close(release)
+				wg.Wait()
+			}
+
+			if got := requests.Load(); got != test.want {
+				t.Errorf("expected %v requests, got %v", test.want, got)
+			}
+			if _, ok := exp.latestData("sn-1"); ok != (test.want > 0) {
+				t.Errorf("expected data %v, got %v", test.want > 0, ok)
+			}
+		})
+	}
+}
+
+func TestRefreshTimeout(t *testing.T) {
+	_, srv := newTestAPI(t, fakeapi.Config{Token: testToken, Inverters: []string{"sn-1"}})
+	cfg := testConfig("sn-1")
+	cfg.APIFetchMode = config.FetchModeScrape
+
+	release := make(chan struct{})
+	block := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		<-release
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	exp := newTestExporter(t, cfg, srv.URL, testToken, block)
+
+	// the scrape gives up waiting, the fetch completes in the background
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	exp.Refresh(ctx)
+	if _, ok := exp.latestData("sn-1"); ok {
+		t.Fatal("expected no data before the fetch completes")
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		if _, ok := exp.latestData("sn-1"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected data once the fetch completes")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	stateVersion = 1
+)
+
+type state struct {
+	Version  int                        `json:"version"`
+	SavedAt  time.Time                  `json:"saved_at"`
+	Energy   map[string]*inverterEnergy `json:"energy"`
+	Readings []metricData               `json:"readings"`
+	Usage    usageState                 `json:"usage"`
+}
+
+func loadState(path string) (*state, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &state{Version: stateVersion}, nil
+		}
+		return nil, err
+	}
+
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("could not unmarshal state: %w", err)
+	}
+	if st.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported state version: %v", st.Version)
+	}
+
+	for i := range st.Readings {
+		st.Readings[i].Restored = true
+		if st.Readings[i].Source == "" {
+			st.Readings[i].Source = sourceCloud
+		}
+	}
+	return &st, nil
+}
+
+// saveState atomically replaces the state file, the state is written to a temporary file
+// in the same directory which is then renamed over the previous state.
+func saveState(path string, st state) error {
+	st.Version = stateVersion
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("could not marshal state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runPersist persists the state every save interval when it changed, until the exporter is shut down.
+func (e *Exporter) runPersist() {
+	if e.stateFile == "" || e.stateInterval <= 0 {
+		return
+	}
+
+	tick := time.NewTicker(e.stateInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if e.stateDirty.Swap(false) {
+				e.persistState()
+			}
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func (e *Exporter) persistState() {
+	if e.stateFile == "" {
+		return
+	}
+
+	var readings []metricData
+	if data := e.data.Load(); data != nil {
+		readings = *data
+	}
+
+	e.energyMu.Lock()
+	defer e.energyMu.Unlock()
+
+	st := state{
+		SavedAt:  time.Now(),
+		Energy:   e.energy,
+		Readings: readings,
+		Usage:    e.usage.snapshot(),
+	}
+	if err := saveState(e.stateFile, st); err != nil {
+		e.log.Error("could not save state", zap.String("path", e.stateFile), zap.Error(err))
+	}
+}
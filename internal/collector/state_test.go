@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"go.uber.org/zap"
+)
+
+func TestLoadState(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{name: "missing file", valid: true},
+		{name: "current version", content: `{"version":1,"readings":[{"InverterSN":"sn-1"}]}`, valid: true},
+		{name: "unsupported version", content: `{"version":2}`},
+		{name: "invalid json", content: `{"version":`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			if test.content != "" {
+				if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+					t.Fatalf("could not write state: %v", err)
+				}
+			}
+
+			st, err := loadState(path)
+			if !test.valid {
+				if err == nil {
+					t.Error("expected invalid state error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not load state: %v", err)
+			}
+			if st.Version != stateVersion {
+				t.Errorf("expected version %v, got %v", stateVersion, st.Version)
+			}
+			for _, d := range st.Readings {
+				if !d.Restored || d.Source != sourceCloud {
+					t.Errorf("%v: expected restored cloud reading, got restored %v and source %q", d.InverterSN, d.Restored, d.Source)
+				}
+			}
+		})
+	}
+}
+
+func TestPersistState(t *testing.T) {
+	cfg := testConfig("sn-1")
+	cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+	exp, err := New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("could not create exporter: %v", err)
+	}
+
+	reading := func(inverterSN string, minutes int, yield float64) metricData {
+		d := metricData{InverterSN: inverterSN, Source: sourceCloud, UpdateTime: testNow.Add(time.Duration(minutes) * time.Minute)}
+		d.setVariable(foxesscloud.VariableTodayYield, yield)
+		d.setVariable(foxesscloud.VariablePvPower, 2)
+		return d
+	}
+	exp.storeData([]metricData{reading("sn-1", 0, 5), reading("sn-2", 0, 1)})
+	exp.storeData([]metricData{reading("sn-1", 6, 6), reading("sn-2", 6, 2)})
+	exp.usage.record(testNow)
+	exp.persistState()
+
+	// the restored exporter does not serve readings of inverters which are no longer configured
+	restored, err := New(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("could not create restored exporter: %v", err)
+	}
+	d, ok := restored.latestData("sn-1")
+	if !ok || !d.Restored || !d.UpdateTime.Equal(testNow.Add(time.Minute*6)) || d.TodayGeneratedPower != 6 {
+		t.Errorf("expected restored reading of sn-1, got %+v (found %v)", d, ok)
+	}
+	if _, ok := restored.latestData("sn-2"); ok {
+		t.Error("expected no restored reading of sn-2")
+	}
+	if got := restored.usage.snapshot().Total; got != 1 {
+		t.Errorf("expected 1 restored api request, got %v", got)
+	}
+
+	// energy counters continue from the restored state
+	data := []metricData{reading("sn-1", 12, 7)}
+	restored.updateEnergy(data)
+	if got := data[0].GeneratedEnergyTotal; !approxEqual(got, 2) {
+		t.Errorf("expected generated energy 2, got %v", got)
+	}
+	if got := data[0].IntegratedEnergy["photovoltaic"]; !approxEqual(got, 0.4) {
+		t.Errorf("expected integrated energy 0.4, got %v", got)
+	}
+}
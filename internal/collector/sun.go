@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	julianUnixEpoch = 2440587.5
+	julian2000      = 2451545.0
+	// altitude of the sun center at sunrise and sunset, accounts for refraction and the sun radius
+	sunriseAltitude = -0.833
+	earthTilt       = 23.4397
+)
+
+// sunTimes returns the sunrise and sunset of the solar day n (days since 2000-01-01 12:00 UTC)
+// at the given location. Polar day returns zero times with up set to true, polar night with up set to false.
+func sunTimes(n float64, latitude, longitude float64) (sunrise, sunset time.Time, up bool) {
+	meanNoon := n - longitude/360
+	anomaly := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	center := 1.9148*sinDeg(anomaly) + 0.02*sinDeg(2*anomaly) + 0.0003*sinDeg(3*anomaly)
+	eclipticLongitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := julian2000 + meanNoon + 0.0053*sinDeg(anomaly) - 0.0069*sinDeg(2*eclipticLongitude)
+
+	sinDeclination := sinDeg(eclipticLongitude) * sinDeg(earthTilt)
+	cosDeclination := math.Cos(math.Asin(sinDeclination))
+	cosHourAngle := (sinDeg(sunriseAltitude) - sinDeg(latitude)*sinDeclination) / (cosDeg(latitude) * cosDeclination)
+	switch {
+	case cosHourAngle < -1:
+		return time.Time{}, time.Time{}, true
+	case cosHourAngle > 1:
+		return time.Time{}, time.Time{}, false
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+	return fromJulian(transit - hourAngle/360), fromJulian(transit + hourAngle/360), true
+}
+
+// darkness returns zero when the sun is up at t, otherwise the time to the nearest sunrise or sunset.
+// Polar night returns the maximum duration.
+func darkness(t time.Time, latitude, longitude float64) time.Duration {
+	day := math.Floor(toJulian(t) - julian2000)
+	res := time.Duration(math.MaxInt64)
+	for n := day - 1; n <= day+1; n++ {
+		sunrise, sunset, up := sunTimes(n, latitude, longitude)
+		if sunrise.IsZero() {
+			if up && n == day {
+				return 0
+			}
+			continue
+		}
+		if !t.Before(sunrise) && !t.After(sunset) {
+			return 0
+		}
+		res = min(res, absDuration(t.Sub(sunrise)), absDuration(t.Sub(sunset)))
+	}
+	return res
+}
+
+func toJulian(t time.Time) float64 {
+	return float64(t.UnixMilli())/float64(24*time.Hour/time.Millisecond) + julianUnixEpoch
+}
+
+func fromJulian(j float64) time.Time {
+	return time.UnixMilli(int64((j - julianUnixEpoch) * float64(24*time.Hour/time.Millisecond)))
+}
+
+func sinDeg(deg float64) float64 {
+	return math.Sin(deg * math.Pi / 180)
+}
+
+func cosDeg(deg float64) float64 {
+	return math.Cos(deg * math.Pi / 180)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,327 @@
+package collector
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jbub/foxesscloud_exporter/internal/modbus"
+	"github.com/prometheus/common/version"
+)
+
+const (
+	sunspecBaseAddress = 40000
+
+	sunspecCommonModel   = 1
+	sunspecInverterModel = 103
+	// vendor specific model carrying data quality and values without a SunSpec counterpart
+	sunspecExporterModel = 64200
+	sunspecEndModel      = 0xFFFF
+
+	sunspecCommonLength   = 66
+	sunspecInverterLength = 50
+	sunspecExporterLength = 29
+
+	// powers are written in tens of watts so that they do not overflow the int16 registers below 327 kW
+	sunspecPowerSF = 1
+
+	sunspecNotImplementedUint16 = 0xFFFF
+	sunspecNotImplementedInt16  = -0x8000
+	sunspecNotImplementedUint32 = 0xFFFFFFFF
+)
+
+// quality flags of the exporter model
+const (
+	qualityNoData = 1 << iota
+	qualityStale
+	qualityRestored
+	qualityLocal
+	qualityFault
+)
+
+type sunspecHandler struct {
+	e          *Exporter
+	units      map[byte]string
+	staleAfter time.Duration
+}
+
+// ModbusHandler returns a Modbus handler serving the latest readings of every inverter in a SunSpec
+// register layout, inverters are served under unit ids assigned in order starting at 1.
+func (e *Exporter) ModbusHandler() modbus.Handler {
+	units := make(map[byte]string, len(e.inverters))
+	for i, inverterSN := range e.inverters {
+		if i >= 247 {
+			break
+		}
+		units[byte(i+1)] = inverterSN
+	}
+	return &sunspecHandler{
+		e:          e,
+		units:      units,
+		staleAfter: e.modbusStaleAfter,
+	}
+}
+
+func (h *sunspecHandler) ReadRegisters(unitID, function byte, address, quantity uint16) ([]uint16, error) {
+	inverterSN, ok := h.units[unitID]
+	if !ok {
+		return nil, &modbus.ExceptionError{Function: function, Code: modbus.ExceptionIllegalDataAddress}
+	}
+
+	d, ok := h.e.latestData(inverterSN)
+	regs := sunspecRegisters(unitID, inverterSN, d, ok, time.Now(), h.staleAfter)
+
+	start := int(address) - sunspecBaseAddress
+	if start < 0 || start+int(quantity) > len(regs) {
+		return nil, &modbus.ExceptionError{Function: function, Code: modbus.ExceptionIllegalDataAddress}
+	}
+	return regs[start : start+int(quantity)], nil
+}
+
+func sunspecRegisters(unitID byte, inverterSN string, d metricData, ok bool, now time.Time, staleAfter time.Duration) []uint16 {
+	w := &registerWriter{}
+	w.string("SunS", 2)
+
+	w.uint16(sunspecCommonModel)
+	w.uint16(sunspecCommonLength)
+	w.string("Fox ESS", 16)
+	w.string("Inverter", 16)
+	// the exporter has no product options, the data source is served by the exporter model
+	w.string("", 8)
+	w.string(version.Version, 8)
+	w.string(inverterSN, 16)
+	w.uint16(uint16(unitID))
+	w.int16(sunspecNotImplementedInt16)
+
+	w.missing = !ok
+
+	w.uint16(sunspecInverterModel)
+	w.uint16(sunspecInverterLength)
+	w.scaledUint16(math.Abs(d.ReferenceCurrent)+math.Abs(d.SecondaryCurrent)+math.Abs(d.TertiaryCurrent), -1)
+	w.scaledUint16(math.Abs(d.ReferenceCurrent), -1)
+	w.scaledUint16(math.Abs(d.SecondaryCurrent), -1)
+	w.scaledUint16(math.Abs(d.TertiaryCurrent), -1)
+	w.int16(-1)
+	w.uint16(sunspecNotImplementedUint16)
+	w.uint16(sunspecNotImplementedUint16)
+	w.uint16(sunspecNotImplementedUint16)
+	w.scaledUint16(d.ReferenceVoltage, -1)
+	w.scaledUint16(d.SecondaryVoltage, -1)
+	w.scaledUint16(d.TertiaryVoltage, -1)
+	w.int16(-1)
+	w.scaledInt16(d.OutputPower*1000, sunspecPowerSF)
+	w.int16(sunspecPowerSF)
+	w.scaledUint16(d.ReferenceFrequency, -2)
+	w.int16(-2)
+	w.int16(sunspecNotImplementedInt16)
+	w.int16(sunspecNotImplementedInt16)
+	w.int16(sunspecNotImplementedInt16)
+	w.int16(sunspecNotImplementedInt16)
+	w.int16(sunspecNotImplementedInt16)
+	w.int16(sunspecNotImplementedInt16)
+	w.scaledAcc32(d.TotalGeneratedPower*1000, 0)
+	w.int16(0)
+	w.uint16(sunspecNotImplementedUint16)
+	w.int16(sunspecNotImplementedInt16)
+	w.uint16(sunspecNotImplementedUint16)
+	w.int16(sunspecNotImplementedInt16)
+	w.scaledInt16(d.PhotovoltaicPower*1000, sunspecPowerSF)
+	w.int16(sunspecPowerSF)
+	w.scaledInt16(d.AmbientTemperature, -1)
+	w.scaledInt16(d.InverterTemperature, -1)
+	w.int16(sunspecNotImplementedInt16)
+	w.scaledInt16(d.BoostTemperature, -1)
+	w.int16(-1)
+	w.enum16(sunspecOperatingState(d.RunningState))
+	w.enum16(uint16(d.RunningState))
+	w.bitfield32(0)
+	w.bitfield32(0)
+	low, high := faultBitfields(d.Faults)
+	w.bitfield32(low)
+	w.bitfield32(high)
+	w.bitfield32(0)
+	w.bitfield32(0)
+
+	w.missing = false
+
+	var quality uint16
+	var updated, age uint32 = sunspecNotImplementedUint32, sunspecNotImplementedUint32
+	if ok {
+		updated = uint32(d.UpdateTime.Unix())
+		age = uint32(max(now.Sub(d.UpdateTime), 0) / time.Second)
+		if staleAfter > 0 && now.Sub(d.UpdateTime) > staleAfter {
+			quality |= qualityStale
+		}
+		if d.Restored {
+			quality |= qualityRestored
+		}
+		if d.Source == sourceLocal {
+			quality |= qualityLocal
+		}
+		if len(d.Faults) > 0 {
+			quality |= qualityFault
+		}
+	} else {
+		quality |= qualityNoData
+	}
+
+	w.uint16(sunspecExporterModel)
+	w.uint16(sunspecExporterLength)
+	w.uint16(quality)
+	w.uint32(updated)
+	w.uint32(age)
+
+	w.missing = !ok
+
+	w.enum16(boolToUint16(d.Source == sourceLocal))
+	w.scaledUint16(d.FaultCount, 0)
+	w.scaledUint16(firstFaultCode(d.Faults), 0)
+	w.scaledInt16(d.LoadPower*1000, sunspecPowerSF)
+	w.scaledInt16(d.FeedInPower*1000, sunspecPowerSF)
+	w.scaledInt16(d.GridConsumptionPower*1000, sunspecPowerSF)
+	w.scaledAcc32(d.TodayGeneratedPower*1000, 0)
+	w.int16(-1)
+	w.int16(-1)
+	w.int16(sunspecPowerSF)
+	w.int16(0)
+	for _, pv := range [][3]float64{
+		{d.PV1Voltage, d.PV1Current, d.PV1Power},
+		{d.PV2Voltage, d.PV2Current, d.PV2Power},
+		{d.PV3Voltage, d.PV3Current, d.PV3Power},
+		{d.PV4Voltage, d.PV4Current, d.PV4Power},
+	} {
+		w.scaledUint16(pv[0], -1)
+		w.scaledUint16(math.Abs(pv[1]), -1)
+		w.scaledInt16(pv[2]*1000, sunspecPowerSF)
+	}
+
+	w.missing = false
+
+	w.uint16(sunspecEndModel)
+	w.uint16(0)
+	return w.regs
+}
+
+// sunspecOperatingState maps the Fox ESS running state to the SunSpec operating state.
+func sunspecOperatingState(state float64) uint16 {
+	switch state {
+	case 160, 162:
+		return 3 // starting
+	case 161, 167:
+		return 8 // standby
+	case 163, 164:
+		return 4 // mppt
+	case 165, 166:
+		return 7 // fault
+	default:
+		return sunspecNotImplementedUint16
+	}
+}
+
+// faultBitfields sets bit n-1 for every active fault code n, codes above 64 are ignored.
+func faultBitfields(faults []fault) (uint32, uint32) {
+	var low, high uint32
+	for _, f := range faults {
+		code, err := strconv.Atoi(f.Code)
+		if err != nil {
+			continue
+		}
+		switch {
+		case code >= 1 && code <= 32:
+			low |= 1 << (code - 1)
+		case code >= 33 && code <= 64:
+			high |= 1 << (code - 33)
+		}
+	}
+	return low, high
+}
+
+func firstFaultCode(faults []fault) float64 {
+	for _, f := range faults {
+		if code, err := strconv.Atoi(f.Code); err == nil {
+			return float64(code)
+		}
+	}
+	return 0
+}
+
+func boolToUint16(b bool) uint16 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// registerWriter appends SunSpec encoded values, measured values are written as not implemented
+// while missing is set.
+type registerWriter struct {
+	regs    []uint16
+	missing bool
+}
+
+func (w *registerWriter) uint16(v uint16) {
+	w.regs = append(w.regs, v)
+}
+
+func (w *registerWriter) int16(v int16) {
+	w.regs = append(w.regs, uint16(v))
+}
+
+func (w *registerWriter) uint32(v uint32) {
+	w.regs = append(w.regs, uint16(v>>16), uint16(v))
+}
+
+func (w *registerWriter) string(s string, words int) {
+	buf := make([]byte, words*2)
+	copy(buf, s)
+	for i := 0; i < words; i++ {
+		w.regs = append(w.regs, uint16(buf[i*2])<<8|uint16(buf[i*2+1]))
+	}
+}
+
+func (w *registerWriter) enum16(v uint16) {
+	if w.missing {
+		v = sunspecNotImplementedUint16
+	}
+	w.uint16(v)
+}
+
+func (w *registerWriter) bitfield32(v uint32) {
+	if w.missing {
+		v = sunspecNotImplementedUint32
+	}
+	w.uint32(v)
+}
+
+func (w *registerWriter) scaledUint16(value float64, sf int) {
+	if w.missing {
+		w.uint16(sunspecNotImplementedUint16)
+		return
+	}
+	w.uint16(uint16(clamp(scale(value, sf), 0, sunspecNotImplementedUint16-1)))
+}
+
+func (w *registerWriter) scaledInt16(value float64, sf int) {
+	if w.missing {
+		w.int16(sunspecNotImplementedInt16)
+		return
+	}
+	w.int16(int16(clamp(scale(value, sf), sunspecNotImplementedInt16+1, math.MaxInt16)))
+}
+
+func (w *registerWriter) scaledAcc32(value float64, sf int) {
+	// accumulators use zero as the not implemented value
+	if w.missing {
+		w.uint32(0)
+		return
+	}
+	w.uint32(uint32(clamp(scale(value, sf), 0, math.MaxUint32)))
+}
+
+func scale(value float64, sf int) float64 {
+	return math.Round(value / math.Pow10(sf))
+}
+
+func clamp(value, lo, hi float64) float64 {
+	return math.Min(math.Max(value, lo), hi)
+}
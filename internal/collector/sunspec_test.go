@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sunspecModel struct {
+	id      uint16
+	address int
+	regs    []uint16
+}
+
+// decodeSunspecModels walks the models following the SunSpec marker.
+func decodeSunspecModels(t *testing.T, regs []uint16) []sunspecModel {
+	t.Helper()
+	if len(regs) < 2 || regs[0] != 0x5375 || regs[1] != 0x6e53 {
+		t.Fatalf("expected SunS marker, got %v", regs[:min(len(regs), 2)])
+	}
+	var res []sunspecModel
+	for offset := 2; ; {
+		if offset+2 > len(regs) {
+			t.Fatalf("model header at %v out of range", sunspecBaseAddress+offset)
+		}
+		id, length := regs[offset], int(regs[offset+1])
+		if offset+2+length > len(regs) {
+			t.Fatalf("model %v at %v with length %v out of range", id, sunspecBaseAddress+offset, length)
+		}
+		res = append(res, sunspecModel{id: id, address: sunspecBaseAddress + offset, regs: regs[offset+2 : offset+2+length]})
+		if id == sunspecEndModel {
+			if offset+2+length != len(regs) {
+				t.Errorf("expected end model to be last, %v registers follow", len(regs)-offset-2-length)
+			}
+			return res
+		}
+		offset += 2 + length
+	}
+}
+
+func TestSunspecRegisters(t *testing.T) {
+	d := metricData{
+		InverterSN:        "sn-1",
+		Source:            sourceCloud,
+		UpdateTime:        testNow.Add(-time.Minute),
+		OutputPower:       40,
+		PhotovoltaicPower: 41.5,
+		LoadPower:         35.12,
+		FeedInPower:       4.9,
+		PV1Power:          20.5,
+		Faults:            []fault{{Code: "12"}},
+		FaultCount:        1,
+	}
+	tests := []struct {
+		name string
+		ok   bool
+		// register values by offset relative to the model data
+		inverter map[int]uint16
+		exporter map[int]uint16
+	}{
+		{
+			name: "reading",
+			ok:   true,
+			// powers above the int16 range in watts are written in tens of watts
+			inverter: map[int]uint16{12: 4000, 13: sunspecPowerSF, 29: 4150, 30: sunspecPowerSF, 38: 0, 42: 0, 43: 1 << 11},
+			exporter: map[int]uint16{0: qualityFault, 4: 60, 5: 0, 6: 1, 7: 12, 8: 3512, 9: 490, 15: sunspecPowerSF, 19: 2050},
+		},
+		{
+			name:     "no reading",
+			inverter: map[int]uint16{12: 0x8000, 13: sunspecPowerSF, 29: 0x8000, 36: 0xFFFF, 38: 0xFFFF, 42: 0xFFFF},
+			exporter: map[int]uint16{0: qualityNoData, 1: 0xFFFF, 3: 0xFFFF, 5: 0xFFFF, 8: 0x8000, 11: 0, 12: 0, 15: sunspecPowerSF},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			models := decodeSunspecModels(t, sunspecRegisters(1, "sn-1", d, test.ok, testNow, time.Hour))
+
+			var ids []uint16
+			lengths := make(map[uint16]int)
+			for _, m := range models {
+				ids = append(ids, m.id)
+				lengths[m.id] = len(m.regs)
+			}
+			wantIDs := []uint16{sunspecCommonModel, sunspecInverterModel, sunspecExporterModel, sunspecEndModel}
+			if !slices.Equal(ids, wantIDs) {
+				t.Fatalf("expected models %v, got %v", wantIDs, ids)
+			}
+			wantLengths := map[uint16]int{sunspecCommonModel: sunspecCommonLength, sunspecInverterModel: sunspecInverterLength, sunspecExporterModel: sunspecExporterLength, sunspecEndModel: 0}
+			for id, length := range wantLengths {
+				if lengths[id] != length {
+					t.Errorf("model %v: expected length %v, got %v", id, length, lengths[id])
+				}
+			}
+			if models[1].address != 40070 || models[2].address != 40122 || models[3].address != 40153 {
+				t.Errorf("expected documented model addresses, got %v, %v and %v", models[1].address, models[2].address, models[3].address)
+			}
+
+			common := models[0].regs
+			if got := decodeSunspecString(common[0:16]); got != "Fox ESS" {
+				t.Errorf("expected manufacturer Fox ESS, got %q", got)
+			}
+			if got := decodeSunspecString(common[32:40]); got != "" {
+				t.Errorf("expected empty options, got %q", got)
+			}
+			if got := decodeSunspecString(common[48:64]); got != "sn-1" {
+				t.Errorf("expected serial number sn-1, got %q", got)
+			}
+
+			for model, want := range map[int]map[int]uint16{1: test.inverter, 2: test.exporter} {
+				for offset, value := range want {
+					if got := models[model].regs[offset]; got != value {
+						t.Errorf("model %v offset %v: expected %#x, got %#x", models[model].id, offset, value, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func decodeSunspecString(regs []uint16) string {
+	var b []byte
+	for _, r := range regs {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return strings.TrimRight(string(b), "\x00")
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// readings older than this are not exposed, Prometheus rejects samples too far in the past
+	maxTimestampAge = time.Hour
+)
+
+// sampleTimestamps decides the timestamps of the exposed samples. Timestamps of an inverter never go back,
+// so that Prometheus does not reject the samples as out of order.
+type sampleTimestamps struct {
+	enabled bool
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func newSampleTimestamps(enabled bool) *sampleTimestamps {
+	return &sampleTimestamps{
+		enabled: enabled,
+		last:    make(map[string]time.Time),
+	}
+}
+
+// get returns the timestamp of the inverter samples, zero time means the scrape time. Samples of readings
+// which are too old or older than an already exposed reading must not be exposed.
+func (t *sampleTimestamps) get(inverterSN string, updateTime time.Time, now time.Time) (time.Time, bool) {
+	if !t.enabled {
+		return time.Time{}, true
+	}
+	if updateTime.IsZero() || now.Sub(updateTime) > maxTimestampAge {
+		return time.Time{}, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if updateTime.Before(t.last[inverterSN]) {
+		return time.Time{}, false
+	}
+	t.last[inverterSN] = updateTime
+	return updateTime, true
+}
+
+func withTimestamp(m prometheus.Metric, ts time.Time) prometheus.Metric {
+	if ts.IsZero() {
+		return m
+	}
+	return prometheus.NewMetricWithTimestamp(ts, m)
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSampleTimestamps(t *testing.T) {
+	type sample struct {
+		inverterSN string
+		age        time.Duration
+		want       time.Duration
+		exposed    bool
+	}
+	tests := []struct {
+		name    string
+		enabled bool
+		samples []sample
+	}{
+		{
+			name: "disabled",
+			samples: []sample{
+				{inverterSN: "sn-1", age: time.Hour * 2, exposed: true},
+				{inverterSN: "sn-1", age: time.Hour * 3, exposed: true},
+			},
+		},
+		{
+			name:    "reading time",
+			enabled: true,
+			samples: []sample{
+				{inverterSN: "sn-1", age: time.Minute * 5, want: time.Minute * 5, exposed: true},
+				{inverterSN: "sn-1", age: time.Minute * 5, want: time.Minute * 5, exposed: true},
+				{inverterSN: "sn-1", age: time.Minute, want: time.Minute, exposed: true},
+			},
+		},
+		{
+			// every inverter has its own last timestamp
+			name:    "out of order",
+			enabled: true,
+			samples: []sample{
+				{inverterSN: "sn-1", age: time.Minute, want: time.Minute, exposed: true},
+				{inverterSN: "sn-1", age: time.Minute * 5},
+				{inverterSN: "sn-2", age: time.Minute * 5, want: time.Minute * 5, exposed: true},
+			},
+		},
+		{
+			name:    "max age",
+			enabled: true,
+			samples: []sample{
+				{inverterSN: "sn-1", age: maxTimestampAge, want: maxTimestampAge, exposed: true},
+				{inverterSN: "sn-2", age: maxTimestampAge + time.Second},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ts := newSampleTimestamps(test.enabled)
+			for i, s := range test.samples {
+				var want time.Time
+				if s.exposed && test.enabled {
+					want = testNow.Add(-s.want)
+				}
+				got, exposed := ts.get(s.inverterSN, testNow.Add(-s.age), testNow)
+				if exposed != s.exposed || !got.Equal(want) {
+					t.Errorf("sample %v: expected %v (exposed %v), got %v (exposed %v)", i, want, s.exposed, got, exposed)
+				}
+			}
+		})
+	}
+}
+
+func TestSampleTimestampsZeroUpdateTime(t *testing.T) {
+	ts := newSampleTimestamps(true)
+	if _, exposed := ts.get("sn-1", time.Time{}, testNow); exposed {
+		t.Error("expected reading without update time not to be exposed")
+	}
+}
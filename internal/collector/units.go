@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/jbub/foxesscloud"
+	"go.uber.org/zap"
+)
+
+// unitScales converts the values reported in the unit to the units the metrics expect,
+// power in kW, energy in kWh, voltage in V, current in A, temperature in ℃ and frequency in Hz.
+var unitScales = map[string]float64{
+	"":    1,
+	"W":   0.001,
+	"kW":  1,
+	"Wh":  0.001,
+	"kWh": 1,
+	"V":   1,
+	"A":   1,
+	"℃":   1,
+	"°C":  1,
+	"Hz":  1,
+}
+
+// unitNormaliser scales the values by their reported unit, unknown units are logged once per variable.
+type unitNormaliser struct {
+	log     *zap.Logger
+	mu      sync.Mutex
+	unknown map[foxesscloud.Variable]bool
+}
+
+func newUnitNormaliser(log *zap.Logger) *unitNormaliser {
+	return &unitNormaliser{
+		log:     log,
+		unknown: make(map[foxesscloud.Variable]bool),
+	}
+}
+
+// normalise returns the value in the unit the metrics expect, values in unknown units are returned as is.
+func (n *unitNormaliser) normalise(variable foxesscloud.Variable, unit string, value float64) float64 {
+	if scale, ok := unitScales[strings.TrimSpace(unit)]; ok {
+		return value * scale
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if !n.unknown[variable] {
+		n.unknown[variable] = true
+		n.log.Warn("unknown unit of variable, value is used as is",
+			zap.String("variable", string(variable)),
+			zap.String("unit", unit),
+		)
+	}
+	return value
+}
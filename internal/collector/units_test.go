@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/jbub/foxesscloud"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestUnitNormaliser(t *testing.T) {
+	tests := []struct {
+		unit  string
+		value float64
+		want  float64
+	}{
+		{unit: "W", value: 2500, want: 2.5},
+		{unit: "kW", value: 2.5, want: 2.5},
+		{unit: "Wh", value: 1500, want: 1.5},
+		{unit: "kWh", value: 1.5, want: 1.5},
+		{unit: " kW ", value: 2.5, want: 2.5},
+		{unit: "", value: 230.1, want: 230.1},
+		{unit: "℃", value: 35, want: 35},
+		{unit: "MW", value: 2, want: 2},
+	}
+	for _, test := range tests {
+		n := newUnitNormaliser(zap.NewNop())
+		if got := n.normalise(foxesscloud.VariablePvPower, test.unit, test.value); !approxEqual(got, test.want) {
+			t.Errorf("%v %q: expected %v, got %v", test.value, test.unit, test.want, got)
+		}
+	}
+}
+
+func TestUnitNormaliserUnknownUnit(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	n := newUnitNormaliser(zap.New(core))
+
+	// unknown units are logged once per variable
+	n.normalise(foxesscloud.VariablePvPower, "MW", 2)
+	n.normalise(foxesscloud.VariablePvPower, "MW", 3)
+	n.normalise(foxesscloud.VariableLoadsPower, "MW", 1)
+	n.normalise(foxesscloud.VariableLoadsPower, "kW", 1)
+	if got := logs.Len(); got != 2 {
+		t.Errorf("expected 2 unknown unit logs, got %v", got)
+	}
+}
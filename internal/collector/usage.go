@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// apiUsage tracks the number of API requests made, the Fox ESS API limits the number of requests per day.
+type apiUsage struct {
+	mu    sync.Mutex
+	usage usageState
+}
+
+type usageState struct {
+	Day   string  `json:"day"`
+	Today float64 `json:"today"`
+	Total float64 `json:"total"`
+}
+
+func newAPIUsage(st usageState) *apiUsage {
+	return &apiUsage{usage: st}
+}
+
+func (u *apiUsage) record(now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if day := now.Format(time.DateOnly); day != u.usage.Day {
+		u.usage.Day = day
+		u.usage.Today = 0
+	}
+	u.usage.Today++
+	u.usage.Total++
+}
+
+func (u *apiUsage) get(now time.Time) usageState {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	st := u.usage
+	if st.Day != now.Format(time.DateOnly) {
+		st.Today = 0
+	}
+	return st
+}
+
+func (u *apiUsage) snapshot() usageState {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.usage
+}
@@ -1,34 +1,129 @@
 package config
 
 import (
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/urfave/cli/v2"
 )
 
+const (
+	FetchModeInterval = "interval"
+	FetchModeScrape   = "scrape"
+
+	MetricNamingLegacy = "legacy"
+	MetricNamingV2     = "v2"
+	MetricNamingBoth   = "both"
+
+	// DefaultAccount is the name of the account using the api-token.
+	DefaultAccount = "default"
+)
+
 func LoadFromCLI(ctx *cli.Context) Config {
 	return Config{
-		LogLevel:         ctx.String("log-level"),
-		ListenAddress:    ctx.String("web.listen-address"),
-		TelemetryPath:    ctx.String("web.telemetry-path"),
-		Inverters:        parseInverters(ctx.String("inverters")),
-		APIToken:         ctx.String("api-token"),
-		APIFetchInterval: ctx.Duration("api-fetch-interval"),
-		APIFetchTimeout:  ctx.Duration("api-fetch-timeout"),
-		DefaultLabels:    ctx.String("default-labels"),
+		LogLevel:               ctx.String("log-level"),
+		ListenAddress:          ctx.String("web.listen-address"),
+		TelemetryPath:          ctx.String("web.telemetry-path"),
+		Inverters:              parseInverters(ctx.String("inverters")),
+		APIToken:               ctx.String("api-token"),
+		APIAccounts:            parseKeyValues(ctx.String("api-accounts")),
+		APIURL:                 ctx.String("api-url"),
+		APIFetchInterval:       ctx.Duration("api-fetch-interval"),
+		APIFetchTimeout:        ctx.Duration("api-fetch-timeout"),
+		APIFetchCycleTimeout:   ctx.Duration("api-fetch-cycle-timeout"),
+		APIFetchConcurrency:    ctx.Int("api-fetch-concurrency"),
+		APIBatchSize:           ctx.Int("api-batch-size"),
+		APIRateLimit:           ctx.Float64("api-rate-limit"),
+		APIFetchMode:           ctx.String("api-fetch-mode"),
+		APIFetchMinAge:         ctx.Duration("api-fetch-min-age"),
+		APIFetchAlign:          ctx.Bool("api-fetch-align"),
+		APIFetchNightInterval:  ctx.Duration("api-fetch-night-interval"),
+		APIFetchRamp:           ctx.Duration("api-fetch-ramp"),
+		APIFetchNightInverters: parseInverters(ctx.String("api-fetch-night-inverters")),
+		SiteLatitude:           ctx.Float64("site.latitude"),
+		SiteLongitude:          ctx.Float64("site.longitude"),
+		SiteLocated:            ctx.IsSet("site.latitude") || ctx.IsSet("site.longitude"),
+		DefaultLabels:          ctx.String("default-labels"),
+		MetricNaming:           ctx.String("metric-naming"),
+		MetricTimestamps:       ctx.Bool("metric-timestamps"),
+		StateFile:              ctx.String("state-file"),
+		StateSaveInterval:      ctx.Duration("state-save-interval"),
+		EnergyMaxGap:           ctx.Duration("energy-max-gap"),
+		EfficiencyMinPower:     ctx.Float64("efficiency.min-power"),
+		EfficiencyThreshold:    ctx.Float64("efficiency.threshold"),
+		LocalInverters:         parseLocalInverters(ctx.String("local-inverters"), ctx.Int("local-unit-id")),
+		ModbusAddress:          ctx.String("modbus.listen-address"),
+		ModbusStaleAfter:       ctx.Duration("modbus.stale-after"),
+		OTLPEndpoint:           ctx.String("otlp.endpoint"),
+		OTLPProtocol:           ctx.String("otlp.protocol"),
+		OTLPHeaders:            parseKeyValues(ctx.String("otlp.headers")),
+		OTLPInsecure:           ctx.Bool("otlp.insecure"),
+		OTLPCAFile:             ctx.String("otlp.ca-file"),
+		OTLPCertFile:           ctx.String("otlp.cert-file"),
+		OTLPKeyFile:            ctx.String("otlp.key-file"),
+		OTLPInterval:           ctx.Duration("otlp.interval"),
+		OTLPMetrics:            ctx.Bool("otlp.metrics"),
+		OTLPTraces:             ctx.Bool("otlp.traces"),
+		RecordDir:              ctx.String("record-dir"),
+		RecordMaxSize:          ctx.Int64("record-max-file-size") * 1024 * 1024,
+		RecordMaxFiles:         ctx.Int("record-max-files"),
 	}
 }
 
 type Config struct {
-	LogLevel         string
-	ListenAddress    string
-	TelemetryPath    string
-	Inverters        []string
-	APIToken         string
-	APIFetchInterval time.Duration
-	APIFetchTimeout  time.Duration
-	DefaultLabels    string
+	LogLevel               string
+	ListenAddress          string
+	TelemetryPath          string
+	Inverters              []string
+	APIToken               string
+	APIAccounts            map[string]string
+	APIURL                 string
+	APIFetchInterval       time.Duration
+	APIFetchTimeout        time.Duration
+	APIFetchCycleTimeout   time.Duration
+	APIFetchConcurrency    int
+	APIBatchSize           int
+	APIRateLimit           float64
+	APIFetchMode           string
+	APIFetchMinAge         time.Duration
+	APIFetchAlign          bool
+	APIFetchNightInterval  time.Duration
+	APIFetchRamp           time.Duration
+	APIFetchNightInverters []string
+	SiteLatitude           float64
+	SiteLongitude          float64
+	SiteLocated            bool
+	DefaultLabels          string
+	MetricNaming           string
+	MetricTimestamps       bool
+	StateFile              string
+	StateSaveInterval      time.Duration
+	EnergyMaxGap           time.Duration
+	EfficiencyMinPower     float64
+	EfficiencyThreshold    float64
+	LocalInverters         []LocalInverter
+	ModbusAddress          string
+	ModbusStaleAfter       time.Duration
+	OTLPEndpoint           string
+	OTLPProtocol           string
+	OTLPHeaders            map[string]string
+	OTLPInsecure           bool
+	OTLPCAFile             string
+	OTLPCertFile           string
+	OTLPKeyFile            string
+	OTLPInterval           time.Duration
+	OTLPMetrics            bool
+	OTLPTraces             bool
+	RecordDir              string
+	RecordMaxSize          int64
+	RecordMaxFiles         int
+}
+
+type LocalInverter struct {
+	InverterSN string
+	Address    string
+	UnitID     byte
 }
 
 func parseInverters(inverters string) []string {
@@ -41,3 +136,59 @@ func parseInverters(inverters string) []string {
 	}
 	return res
 }
+
+// parseLocalInverters parses comma separated list of sn=host:port items,
+// unit id can be set per inverter by appending /unit to the address.
+func parseLocalInverters(inverters string, defaultUnitID int) []LocalInverter {
+	var res []LocalInverter
+	for _, item := range strings.Split(inverters, ",") {
+		inverterSN, addr, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || inverterSN == "" || addr == "" {
+			continue
+		}
+		unitID := defaultUnitID
+		if host, unit, ok := strings.Cut(addr, "/"); ok {
+			if id, err := strconv.Atoi(unit); err == nil {
+				unitID = id
+			}
+			addr = host
+		}
+		res = append(res, LocalInverter{
+			InverterSN: inverterSN,
+			Address:    addr,
+			UnitID:     byte(unitID),
+		})
+	}
+	return res
+}
+
+// parseKeyValues parses comma separated key=value pairs.
+func parseKeyValues(s string) map[string]string {
+	res := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		if key = strings.TrimSpace(key); ok && key != "" {
+			res[key] = strings.TrimSpace(value)
+		}
+	}
+	return res
+}
+
+// ParseLabels parses space separated key=value pairs.
+func ParseLabels(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+
+	items := strings.Split(s, " ")
+	res := make(map[string]string, len(items))
+	for _, item := range items {
+		if item == "" {
+			continue
+		}
+		if parts := strings.SplitN(item, "=", 2); len(parts) == 2 {
+			res[parts[0]] = parts[1]
+		}
+	}
+	return res
+}
@@ -0,0 +1,358 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+	"github.com/jbub/foxesscloud_exporter/internal/openapi"
+)
+
+const (
+	errNoNoError        = 0
+	errNoTokenInvalid   = 41809
+	errHeadersMissing   = 40256
+	errBodyInvalid      = 40257
+	errRequestsFrequent = 40400
+	errDeviceNotFound   = 41930
+
+	timeFormat       = "2006-01-02 15:04:05 MST-0700"
+	maxHistoryPoints = 24 * 60 / 5
+)
+
+// Config configures the fake Fox ESS API server.
+type Config struct {
+	// Token is the API token the requests have to be signed with, any token is accepted when empty.
+	Token string
+	// Inverters are the serial numbers of the simulated inverters.
+	Inverters []string
+	// Location is the timezone of the simulated site, defaults to UTC.
+	Location *time.Location
+	// PeakPower is the photovoltaic power in kW produced at noon.
+	PeakPower float64
+	// Strings is the number of simulated PV strings.
+	Strings int
+	// Installed is the time the simulated inverters were installed at, used to compute the total generation.
+	Installed time.Time
+	// FaultProbability is the probability of an inverter reporting a fault in a 30 minute window.
+	FaultProbability float64
+	// RateLimitProbability is the probability of a request failing with a rate limit error.
+	RateLimitProbability float64
+	// Now returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+// Server serves a subset of the Fox ESS open API with simulated inverter data.
+type Server struct {
+	cfg Config
+	sim *simulation
+	mux *http.ServeMux
+}
+
+func New(cfg Config) *Server {
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.Installed.IsZero() {
+		cfg.Installed = cfg.Now().AddDate(-1, 0, 0)
+	}
+
+	s := &Server{
+		cfg: cfg,
+		sim: &simulation{cfg: cfg},
+		mux: http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /op/v0/device/real/query", s.handleRealtime)
+	s.mux.HandleFunc("POST /op/v1/device/real/query", s.handleRealtimeBatch)
+	s.mux.HandleFunc("POST /op/v0/device/history/query", s.handleHistory)
+	s.mux.HandleFunc("POST /op/v0/device/list", s.handleList)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if errNo, msg := s.checkRequest(req); errNo != errNoNoError {
+		writeError(w, errNo, msg)
+		return
+	}
+	s.mux.ServeHTTP(w, req)
+}
+
+func (s *Server) checkRequest(req *http.Request) (int, string) {
+	token := req.Header.Get("token")
+	timestamp := req.Header.Get("timestamp")
+	signature := req.Header.Get("signature")
+	if token == "" || timestamp == "" || signature == "" {
+		return errHeadersMissing, "illegal signature"
+	}
+	if s.cfg.Token != "" && token != s.cfg.Token {
+		return errNoTokenInvalid, "token invalid"
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || openapi.Signature(token, req.URL.Path, ts) != signature {
+		return errHeadersMissing, "illegal signature"
+	}
+	if s.cfg.RateLimitProbability > 0 && rand.Float64() < s.cfg.RateLimitProbability {
+		return errRequestsFrequent, "Request too frequent"
+	}
+	return errNoNoError, ""
+}
+
+type dataItem struct {
+	Unit     string               `json:"unit,omitempty"`
+	Name     string               `json:"name"`
+	Variable foxesscloud.Variable `json:"variable"`
+	Value    any                  `json:"value"`
+}
+
+type realtimeData struct {
+	Datas    []dataItem `json:"datas"`
+	Time     string     `json:"time"`
+	DeviceSN string     `json:"deviceSN"`
+}
+
+func (s *Server) handleRealtime(w http.ResponseWriter, req *http.Request) {
+	var pld struct {
+		InverterSN string                 `json:"sn"`
+		Variables  []foxesscloud.Variable `json:"variables"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&pld); err != nil {
+		writeError(w, errBodyInvalid, "parameter error")
+		return
+	}
+	if !slices.Contains(s.cfg.Inverters, pld.InverterSN) {
+		writeError(w, errDeviceNotFound, "device not found")
+		return
+	}
+
+	writeResult(w, []realtimeData{s.realtimeData(pld.InverterSN, pld.Variables, s.cfg.Now())})
+}
+
+// handleRealtimeBatch serves realtime data of multiple inverters, unknown inverters are left out of the result.
+func (s *Server) handleRealtimeBatch(w http.ResponseWriter, req *http.Request) {
+	var pld struct {
+		InverterSNs []string               `json:"sns"`
+		Variables   []foxesscloud.Variable `json:"variables"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&pld); err != nil {
+		writeError(w, errBodyInvalid, "parameter error")
+		return
+	}
+	if len(pld.InverterSNs) == 0 || len(pld.InverterSNs) > openapi.MaxBatchSize {
+		writeError(w, errBodyInvalid, "parameter error")
+		return
+	}
+
+	now := s.cfg.Now()
+	res := make([]realtimeData, 0, len(pld.InverterSNs))
+	for _, inverterSN := range pld.InverterSNs {
+		if slices.Contains(s.cfg.Inverters, inverterSN) {
+			res = append(res, s.realtimeData(inverterSN, pld.Variables, now))
+		}
+	}
+	writeResult(w, res)
+}
+
+func (s *Server) realtimeData(inverterSN string, variables []foxesscloud.Variable, now time.Time) realtimeData {
+	readings := s.sim.readings(inverterSN, now)
+	data := realtimeData{
+		Time:     now.In(s.cfg.Location).Truncate(updatePeriod).Format(timeFormat),
+		DeviceSN: inverterSN,
+	}
+	for _, variable := range requestedVariables(variables, readings) {
+		r := readings[variable]
+		data.Datas = append(data.Datas, dataItem{
+			Unit:     r.unit,
+			Name:     r.name,
+			Variable: variable,
+			Value:    r.value,
+		})
+	}
+	return data
+}
+
+type historyPoint struct {
+	Time  string `json:"time"`
+	Value any    `json:"value"`
+}
+
+type historyItem struct {
+	Unit     string               `json:"unit,omitempty"`
+	Name     string               `json:"name"`
+	Variable foxesscloud.Variable `json:"variable"`
+	Data     []historyPoint       `json:"data"`
+}
+
+type historyData struct {
+	Datas    []historyItem `json:"datas"`
+	DeviceSN string        `json:"deviceSN"`
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, req *http.Request) {
+	var pld struct {
+		InverterSN string                 `json:"sn"`
+		Variables  []foxesscloud.Variable `json:"variables"`
+		Begin      int64                  `json:"begin"`
+		End        int64                  `json:"end"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&pld); err != nil {
+		writeError(w, errBodyInvalid, "parameter error")
+		return
+	}
+	if !slices.Contains(s.cfg.Inverters, pld.InverterSN) {
+		writeError(w, errDeviceNotFound, "device not found")
+		return
+	}
+
+	end := s.cfg.Now()
+	if pld.End > 0 && time.UnixMilli(pld.End).Before(end) {
+		end = time.UnixMilli(pld.End)
+	}
+	begin := end.Add(-updatePeriod * maxHistoryPoints)
+	if pld.Begin > 0 && time.UnixMilli(pld.Begin).After(begin) {
+		begin = time.UnixMilli(pld.Begin)
+	}
+
+	items := make(map[foxesscloud.Variable]*historyItem)
+	var order []foxesscloud.Variable
+	for ts := begin.Truncate(updatePeriod); !ts.After(end); ts = ts.Add(updatePeriod) {
+		readings := s.sim.readings(pld.InverterSN, ts)
+		for _, variable := range requestedVariables(pld.Variables, readings) {
+			r := readings[variable]
+			item, ok := items[variable]
+			if !ok {
+				item = &historyItem{Unit: r.unit, Name: r.name, Variable: variable}
+				items[variable] = item
+				order = append(order, variable)
+			}
+			item.Data = append(item.Data, historyPoint{
+				Time:  ts.In(s.cfg.Location).Format(timeFormat),
+				Value: r.value,
+			})
+		}
+	}
+
+	data := historyData{DeviceSN: pld.InverterSN}
+	for _, variable := range order {
+		data.Datas = append(data.Datas, *items[variable])
+	}
+	writeResult(w, []historyData{data})
+}
+
+type device struct {
+	DeviceType  string `json:"deviceType"`
+	HasBattery  bool   `json:"hasBattery"`
+	HasPV       bool   `json:"hasPV"`
+	StationName string `json:"stationName"`
+	ModuleSN    string `json:"moduleSN"`
+	DeviceSN    string `json:"deviceSN"`
+	ProductType string `json:"productType"`
+	StationID   string `json:"stationID"`
+	Status      int    `json:"status"`
+}
+
+func (s *Server) handleList(w http.ResponseWriter, req *http.Request) {
+	var pld struct {
+		CurrentPage int `json:"currentPage"`
+		PageSize    int `json:"pageSize"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&pld); err != nil {
+		writeError(w, errBodyInvalid, "parameter error")
+		return
+	}
+	page := max(pld.CurrentPage, 1)
+	size := pld.PageSize
+	if size <= 0 {
+		size = 10
+	}
+
+	var devices []device
+	for i, inverterSN := range s.cfg.Inverters {
+		if i < (page-1)*size || i >= page*size {
+			continue
+		}
+		devices = append(devices, device{
+			DeviceType:  "H3-10.0-E",
+			HasPV:       true,
+			StationName: "Simulated station",
+			ModuleSN:    "M" + inverterSN,
+			DeviceSN:    inverterSN,
+			ProductType: "H3",
+			StationID:   "simulated-station",
+			Status:      1,
+		})
+	}
+	writeResult(w, map[string]any{
+		"data":        devices,
+		"currentPage": page,
+		"pageSize":    size,
+		"total":       len(s.cfg.Inverters),
+	})
+}
+
+// requestedVariables returns the requested variables known to the simulation,
+// all variables are returned when none are requested.
+func requestedVariables(variables []foxesscloud.Variable, readings map[foxesscloud.Variable]reading) []foxesscloud.Variable {
+	if len(variables) == 0 {
+		variables = make([]foxesscloud.Variable, 0, len(readings))
+		for variable := range readings {
+			variables = append(variables, variable)
+		}
+		slices.Sort(variables)
+	}
+	res := make([]foxesscloud.Variable, 0, len(variables))
+	for _, variable := range variables {
+		if _, ok := readings[variable]; ok {
+			res = append(res, variable)
+		}
+	}
+	return res
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	writeJSON(w, map[string]any{
+		"errno":  errNoNoError,
+		"msg":    "success",
+		"result": result,
+	})
+}
+
+func writeError(w http.ResponseWriter, errNo int, msg string) {
+	writeJSON(w, map[string]any{
+		"errno": errNo,
+		"msg":   msg,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Readings returns the numeric values of the inverter variables simulated at the given time.
+func (s *Server) Readings(inverterSN string, ts time.Time) map[foxesscloud.Variable]float64 {
+	readings := s.sim.readings(inverterSN, ts)
+	res := make(map[foxesscloud.Variable]float64, len(readings))
+	for variable, r := range readings {
+		switch v := r.value.(type) {
+		case float64:
+			res[variable] = v
+		case int:
+			res[variable] = float64(v)
+		case string:
+			// multiple fault codes can not be represented as a number, only the first one is kept
+			first, _, _ := strings.Cut(v, ",")
+			if f, err := strconv.ParseFloat(first, 64); err == nil {
+				res[variable] = f
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,145 @@
+package fakeapi
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+)
+
+const (
+	// the real API refreshes realtime data every few minutes
+	updatePeriod = time.Minute * 5
+	faultWindow  = time.Minute * 30
+	sunrise      = 6.0
+	sunset       = 18.0
+	gridVoltage  = 230.0
+	runningState = 163
+)
+
+var faultCodes = []int{1, 2, 3, 12, 17, 25}
+
+type reading struct {
+	unit  string
+	name  string
+	value any
+}
+
+type simulation struct {
+	cfg Config
+}
+
+// rng returns a random generator seeded by the inverter serial number and time,
+// repeated queries for the same data period return the same values.
+func (s *simulation) rng(inverterSN string, ts time.Time, salt string) *rand.Rand {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(inverterSN))
+	_, _ = h.Write([]byte(salt))
+	_, _ = h.Write([]byte(strconv.FormatInt(ts.Unix(), 10)))
+	return rand.New(rand.NewPCG(h.Sum64(), uint64(len(inverterSN))))
+}
+
+// solarRatio returns the fraction of peak power produced at the given time of day, zero at night.
+func solarRatio(ts time.Time) float64 {
+	hour := float64(ts.Hour()) + float64(ts.Minute())/60 + float64(ts.Second())/3600
+	if hour <= sunrise || hour >= sunset {
+		return 0
+	}
+	return math.Sin(math.Pi * (hour - sunrise) / (sunset - sunrise))
+}
+
+// dailyYield returns the energy in kWh produced from midnight until the given time of day.
+func (s *simulation) dailyYield(ts time.Time) float64 {
+	hour := float64(ts.Hour()) + float64(ts.Minute())/60
+	hour = min(max(hour, sunrise), sunset)
+	length := sunset - sunrise
+	return s.cfg.PeakPower * length / math.Pi * (1 - math.Cos(math.Pi*(hour-sunrise)/length))
+}
+
+func (s *simulation) faults(inverterSN string, ts time.Time) []int {
+	window := ts.Truncate(faultWindow)
+	rnd := s.rng(inverterSN, window, "fault")
+	if rnd.Float64() >= s.cfg.FaultProbability {
+		return nil
+	}
+	return []int{faultCodes[rnd.IntN(len(faultCodes))]}
+}
+
+func round(v float64, precision int) float64 {
+	p := math.Pow10(precision)
+	return math.Round(v*p) / p
+}
+
+func (s *simulation) readings(inverterSN string, ts time.Time) map[foxesscloud.Variable]reading {
+	ts = ts.In(s.cfg.Location).Truncate(updatePeriod)
+	rnd := s.rng(inverterSN, ts, "reading")
+
+	pvPower := s.cfg.PeakPower * solarRatio(ts) * (0.85 + 0.15*rnd.Float64())
+	generationPower := pvPower * 0.97
+	loadPower := 0.3 + 0.5*rnd.Float64()
+	if hour := ts.Hour(); hour >= 17 && hour <= 21 {
+		loadPower += 1.5
+	}
+	feedinPower := max(generationPower-loadPower, 0)
+	gridConsumptionPower := max(loadPower-generationPower, 0)
+
+	midnight := time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, ts.Location())
+	todayYield := s.dailyYield(ts)
+	totalYield := s.dailyYield(midnight.Add(time.Hour*24-time.Second))*float64(ts.Sub(s.cfg.Installed)/(time.Hour*24)) + todayYield
+
+	faults := s.faults(inverterSN, ts)
+	currentFault := ""
+	for i, code := range faults {
+		if i > 0 {
+			currentFault += ","
+		}
+		currentFault += strconv.Itoa(code)
+	}
+
+	res := map[foxesscloud.Variable]reading{
+		foxesscloud.VariablePvPower:              {unit: "kW", name: "PVPower", value: round(pvPower, 3)},
+		foxesscloud.VariableGenerationPower:      {unit: "kW", name: "Output Power", value: round(generationPower, 3)},
+		foxesscloud.VariableLoadsPower:           {unit: "kW", name: "Load Power", value: round(loadPower, 3)},
+		foxesscloud.VariableFeedinPower:          {unit: "kW", name: "Feed-in Power", value: round(feedinPower, 3)},
+		foxesscloud.VariableGridConsumptionPower: {unit: "kW", name: "GridConsumption Power", value: round(gridConsumptionPower, 3)},
+		foxesscloud.VariableTodayYield:           {unit: "kWh", name: "Today Yield", value: round(todayYield, 1)},
+		foxesscloud.VariableGeneration:           {unit: "kWh", name: "Cumulative power generation", value: round(totalYield, 1)},
+		foxesscloud.VariableAmbientTemperation:   {unit: "℃", name: "Ambient Temperature", value: round(20+10*solarRatio(ts), 1)},
+		foxesscloud.VariableBoostTemperation:     {unit: "℃", name: "Boost Temperature", value: round(25+20*solarRatio(ts), 1)},
+		foxesscloud.VariableInvTemperation:       {unit: "℃", name: "Inverter Temperature", value: round(25+15*solarRatio(ts), 1)},
+		foxesscloud.VariableRunningState:         {name: "Running State", value: strconv.Itoa(runningState)},
+		foxesscloud.VariableCurrentFaultCount:    {name: "The number of errors", value: len(faults)},
+		foxesscloud.VariableCurrentFault:         {name: "The current error code is reported", value: currentFault},
+	}
+
+	numStrings := max(s.cfg.Strings, 1)
+	for i := range numStrings {
+		power := pvPower / float64(numStrings)
+		volt := 0.0
+		if power > 0 {
+			volt = 300 + 60*rnd.Float64()
+		}
+		current := 0.0
+		if volt > 0 {
+			current = power * 1000 / volt
+		}
+		n := strconv.Itoa(i + 1)
+		res[foxesscloud.Variable("pv"+n+"Volt")] = reading{unit: "V", name: "PV" + n + "Volt", value: round(volt, 1)}
+		res[foxesscloud.Variable("pv"+n+"Current")] = reading{unit: "A", name: "PV" + n + "Current", value: round(current, 1)}
+		res[foxesscloud.Variable("pv"+n+"Power")] = reading{unit: "kW", name: "PV" + n + "Power", value: round(power, 3)}
+	}
+
+	phases := []string{"R", "S", "T"}
+	for _, phase := range phases {
+		power := generationPower / float64(len(phases))
+		volt := gridVoltage + 4*rnd.Float64() - 2
+		res[foxesscloud.Variable(phase+"Power")] = reading{unit: "kW", name: phase + "Power", value: round(power, 3)}
+		res[foxesscloud.Variable(phase+"Volt")] = reading{unit: "V", name: phase + "Volt", value: round(volt, 1)}
+		res[foxesscloud.Variable(phase+"Current")] = reading{unit: "A", name: phase + "Current", value: round(power*1000/volt, 1)}
+		res[foxesscloud.Variable(phase+"Freq")] = reading{unit: "Hz", name: phase + "Freq", value: round(50+0.1*rnd.Float64()-0.05, 2)}
+	}
+	return res
+}
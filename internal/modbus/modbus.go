@@ -0,0 +1,197 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	FuncReadHoldingRegisters = 0x03
+	FuncReadInputRegisters   = 0x04
+
+	ExceptionIllegalFunction     = 0x01
+	ExceptionIllegalDataAddress  = 0x02
+	ExceptionIllegalDataValue    = 0x03
+	ExceptionServerDeviceFailure = 0x04
+
+	// maximum number of registers in a single read request
+	MaxReadQuantity = 125
+
+	protocolID   = 0
+	headerLength = 7
+	maxFrameSize = 260
+)
+
+// ExceptionError is returned when the device responds with a Modbus exception.
+type ExceptionError struct {
+	Function byte
+	Code     byte
+}
+
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("modbus exception %#x for function %#x", e.Code, e.Function)
+}
+
+// Client is a Modbus TCP client reusing a single connection, safe for concurrent use.
+type Client struct {
+	addr    string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	tid  uint16
+}
+
+func NewClient(addr string, timeout time.Duration) *Client {
+	return &Client{
+		addr:    addr,
+		timeout: timeout,
+	}
+}
+
+func (c *Client) ReadHoldingRegisters(ctx context.Context, unitID byte, address, quantity uint16) ([]uint16, error) {
+	return c.readRegisters(ctx, unitID, FuncReadHoldingRegisters, address, quantity)
+}
+
+func (c *Client) ReadInputRegisters(ctx context.Context, unitID byte, address, quantity uint16) ([]uint16, error) {
+	return c.readRegisters(ctx, unitID, FuncReadInputRegisters, address, quantity)
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeConn()
+}
+
+func (c *Client) readRegisters(ctx context.Context, unitID, function byte, address, quantity uint16) ([]uint16, error) {
+	if quantity == 0 || quantity > MaxReadQuantity {
+		return nil, fmt.Errorf("invalid register quantity: %v", quantity)
+	}
+
+	pdu := make([]byte, 5)
+	pdu[0] = function
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], quantity)
+
+	resp, err := c.send(ctx, unitID, pdu)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 || int(resp[1]) != int(quantity)*2 || len(resp) != 2+int(quantity)*2 {
+		return nil, fmt.Errorf("invalid response length: %v", len(resp))
+	}
+
+	regs := make([]uint16, quantity)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(resp[2+i*2:])
+	}
+	return regs, nil
+}
+
+func (c *Client) send(ctx context.Context, unitID byte, pdu []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resp, err := c.roundTrip(ctx, unitID, pdu)
+	if err != nil {
+		// the connection state is unknown after an error, next request reconnects
+		_ = c.closeConn()
+		var errExc *ExceptionError
+		if errors.As(err, &errExc) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not send modbus request to %v: %w", c.addr, err)
+	}
+	return resp, nil
+}
+
+func (c *Client) roundTrip(ctx context.Context, unitID byte, pdu []byte) ([]byte, error) {
+	if c.conn == nil {
+		dialer := net.Dialer{Timeout: c.timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	c.tid++
+	if err := writeFrame(c.conn, c.tid, unitID, pdu); err != nil {
+		return nil, err
+	}
+
+	tid, respUnitID, resp, err := readFrame(c.conn)
+	if err != nil {
+		return nil, err
+	}
+	if tid != c.tid || respUnitID != unitID {
+		return nil, fmt.Errorf("unexpected response transaction %v unit %v", tid, respUnitID)
+	}
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("empty response")
+	}
+	if resp[0] == pdu[0]|0x80 {
+		if len(resp) < 2 {
+			return nil, fmt.Errorf("invalid exception response")
+		}
+		return nil, &ExceptionError{Function: pdu[0], Code: resp[1]}
+	}
+	if resp[0] != pdu[0] {
+		return nil, fmt.Errorf("unexpected response function %#x", resp[0])
+	}
+	return resp, nil
+}
+
+func (c *Client) closeConn() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func writeFrame(w io.Writer, tid uint16, unitID byte, pdu []byte) error {
+	frame := make([]byte, headerLength+len(pdu))
+	binary.BigEndian.PutUint16(frame[0:], tid)
+	binary.BigEndian.PutUint16(frame[2:], protocolID)
+	binary.BigEndian.PutUint16(frame[4:], uint16(len(pdu)+1))
+	frame[6] = unitID
+	copy(frame[headerLength:], pdu)
+	_, err := w.Write(frame)
+	return err
+}
+
+func readFrame(r io.Reader) (uint16, byte, []byte, error) {
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	tid := binary.BigEndian.Uint16(header[0:])
+	if proto := binary.BigEndian.Uint16(header[2:]); proto != protocolID {
+		return 0, 0, nil, fmt.Errorf("invalid protocol id: %v", proto)
+	}
+	length := int(binary.BigEndian.Uint16(header[4:]))
+	if length < 2 || headerLength-1+length > maxFrameSize {
+		return 0, 0, nil, fmt.Errorf("invalid frame length: %v", length)
+	}
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(r, pdu); err != nil {
+		return 0, 0, nil, err
+	}
+	return tid, header[6], pdu, nil
+}
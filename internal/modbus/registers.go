@@ -0,0 +1,162 @@
+package modbus
+
+import (
+	"context"
+	"math"
+	"slices"
+
+	"github.com/jbub/foxesscloud"
+)
+
+// Register maps a Fox ESS variable to a holding register, the value is the raw register value multiplied by Scale.
+type Register struct {
+	Variable foxesscloud.Variable
+	Address  uint16
+	Words    int
+	Signed   bool
+	Scale    float64
+}
+
+// FoxESSRegisters is the holding register layout of Fox ESS inverters read over the LAN.
+// Power registers are in watts, scaled to the kW reported by the cloud API.
+var FoxESSRegisters = []Register{
+	{Variable: foxesscloud.VariablePv1Volt, Address: 31000, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariablePv1Current, Address: 31001, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariablePv1Power, Address: 31002, Words: 1, Signed: true, Scale: 0.001},
+	{Variable: foxesscloud.VariablePv2Volt, Address: 31003, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariablePv2Current, Address: 31004, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariablePv2Power, Address: 31005, Words: 1, Signed: true, Scale: 0.001},
+	{Variable: foxesscloud.VariableRVolt, Address: 31006, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariableRCurrent, Address: 31007, Words: 1, Signed: true, Scale: 0.1},
+	{Variable: foxesscloud.VariableRPower, Address: 31008, Words: 1, Signed: true, Scale: 0.001},
+	{Variable: foxesscloud.VariableRFreq, Address: 31009, Words: 1, Scale: 0.01},
+	{Variable: foxesscloud.VariableSVolt, Address: 31010, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariableSCurrent, Address: 31011, Words: 1, Signed: true, Scale: 0.1},
+	{Variable: foxesscloud.VariableSPower, Address: 31012, Words: 1, Signed: true, Scale: 0.001},
+	{Variable: foxesscloud.VariableSFreq, Address: 31013, Words: 1, Scale: 0.01},
+	{Variable: foxesscloud.VariableTVolt, Address: 31014, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariableTCurrent, Address: 31015, Words: 1, Signed: true, Scale: 0.1},
+	{Variable: foxesscloud.VariableTPower, Address: 31016, Words: 1, Signed: true, Scale: 0.001},
+	{Variable: foxesscloud.VariableTFreq, Address: 31017, Words: 1, Scale: 0.01},
+	{Variable: foxesscloud.VariableGenerationPower, Address: 31018, Words: 1, Signed: true, Scale: 0.001},
+	{Variable: foxesscloud.VariableLoadsPower, Address: 31019, Words: 1, Signed: true, Scale: 0.001},
+	{Variable: foxesscloud.VariableFeedinPower, Address: 31020, Words: 1, Scale: 0.001},
+	{Variable: foxesscloud.VariableGridConsumptionPower, Address: 31021, Words: 1, Scale: 0.001},
+	{Variable: foxesscloud.VariablePvPower, Address: 31022, Words: 1, Scale: 0.001},
+	{Variable: foxesscloud.VariableInvTemperation, Address: 31023, Words: 1, Signed: true, Scale: 0.1},
+	{Variable: foxesscloud.VariableAmbientTemperation, Address: 31024, Words: 1, Signed: true, Scale: 0.1},
+	{Variable: foxesscloud.VariableBoostTemperation, Address: 31025, Words: 1, Signed: true, Scale: 0.1},
+	{Variable: foxesscloud.VariableRunningState, Address: 31026, Words: 1, Scale: 1},
+	{Variable: foxesscloud.VariableCurrentFaultCount, Address: 31027, Words: 1, Scale: 1},
+	{Variable: foxesscloud.VariableCurrentFault, Address: 31028, Words: 1, Scale: 1},
+	{Variable: foxesscloud.VariablePv3Volt, Address: 31039, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariablePv3Current, Address: 31040, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariablePv3Power, Address: 31041, Words: 1, Signed: true, Scale: 0.001},
+	{Variable: foxesscloud.VariablePv4Volt, Address: 31042, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariablePv4Current, Address: 31043, Words: 1, Scale: 0.1},
+	{Variable: foxesscloud.VariablePv4Power, Address: 31044, Words: 1, Signed: true, Scale: 0.001},
+	{Variable: foxesscloud.VariableGeneration, Address: 32000, Words: 2, Scale: 0.1},
+	{Variable: foxesscloud.VariableTodayYield, Address: 32002, Words: 2, Scale: 0.1},
+}
+
+const (
+	// registers closer than this are read in a single request even if there is a gap between them
+	maxReadGap = 16
+)
+
+type readBlock struct {
+	address   uint16
+	quantity  uint16
+	registers []Register
+}
+
+func readBlocks(registers []Register) []readBlock {
+	sorted := slices.Clone(registers)
+	slices.SortFunc(sorted, func(a, b Register) int { return int(a.Address) - int(b.Address) })
+
+	var blocks []readBlock
+	for _, reg := range sorted {
+		end := int(reg.Address) + reg.Words
+		if n := len(blocks); n > 0 {
+			last := &blocks[n-1]
+			lastEnd := int(last.address) + int(last.quantity)
+			if int(reg.Address)-lastEnd <= maxReadGap && end-int(last.address) <= MaxReadQuantity {
+				last.quantity = uint16(max(lastEnd, end) - int(last.address))
+				last.registers = append(last.registers, reg)
+				continue
+			}
+		}
+		blocks = append(blocks, readBlock{
+			address:   reg.Address,
+			quantity:  uint16(reg.Words),
+			registers: []Register{reg},
+		})
+	}
+	return blocks
+}
+
+// ReadVariables reads the registers from the unit and returns their scaled values.
+func ReadVariables(ctx context.Context, client *Client, unitID byte, registers []Register) (map[foxesscloud.Variable]float64, error) {
+	res := make(map[foxesscloud.Variable]float64, len(registers))
+	for _, block := range readBlocks(registers) {
+		regs, err := client.ReadHoldingRegisters(ctx, unitID, block.address, block.quantity)
+		if err != nil {
+			return nil, err
+		}
+		for _, reg := range block.registers {
+			offset := int(reg.Address - block.address)
+			res[reg.Variable] = decodeRegister(reg, regs[offset:offset+reg.Words])
+		}
+	}
+	return res, nil
+}
+
+// EncodeVariables converts the values to raw register values, variables without a register are skipped.
+func EncodeVariables(values map[foxesscloud.Variable]float64, registers []Register) map[uint16]uint16 {
+	res := make(map[uint16]uint16, len(registers))
+	for _, reg := range registers {
+		value, ok := values[reg.Variable]
+		if !ok {
+			continue
+		}
+		raw := clampRaw(reg, int64(math.Round(value/reg.Scale)))
+		switch reg.Words {
+		case 1:
+			res[reg.Address] = uint16(raw)
+		case 2:
+			res[reg.Address] = uint16(uint32(raw) >> 16)
+			res[reg.Address+1] = uint16(uint32(raw))
+		}
+	}
+	return res
+}
+
+// clampRaw clamps the raw value to the range of the register, so that out of range values
+// are not wrapped around, e.g. a negative value in an unsigned register.
+func clampRaw(reg Register, raw int64) int64 {
+	bits := 16 * reg.Words
+	if reg.Signed {
+		return min(max(raw, -1<<(bits-1)), 1<<(bits-1)-1)
+	}
+	return min(max(raw, 0), 1<<bits-1)
+}
+
+func decodeRegister(reg Register, words []uint16) float64 {
+	var raw float64
+	switch reg.Words {
+	case 1:
+		if reg.Signed {
+			raw = float64(int16(words[0]))
+		} else {
+			raw = float64(words[0])
+		}
+	case 2:
+		v := uint32(words[0])<<16 | uint32(words[1])
+		if reg.Signed {
+			raw = float64(int32(v))
+		} else {
+			raw = float64(v)
+		}
+	}
+	return raw * reg.Scale
+}
@@ -0,0 +1,113 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+)
+
+func newTestServer(t *testing.T, regs *Registers) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	srv := NewServer(regs)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func newTestClient(t *testing.T, addr string) *Client {
+	t.Helper()
+	client := NewClient(addr, time.Second*5)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestReadVariables(t *testing.T) {
+	values := map[foxesscloud.Variable]float64{
+		foxesscloud.VariablePv1Volt:              385.4,
+		foxesscloud.VariablePv1Current:           7.3,
+		foxesscloud.VariablePv1Power:             2.813,
+		foxesscloud.VariablePv4Power:             1.25,
+		foxesscloud.VariableRCurrent:             -4.2,
+		foxesscloud.VariableRPower:               -0.965,
+		foxesscloud.VariableRFreq:                49.98,
+		foxesscloud.VariableGenerationPower:      -0.035,
+		foxesscloud.VariableLoadsPower:           1.532,
+		foxesscloud.VariableFeedinPower:          3.1,
+		foxesscloud.VariableGridConsumptionPower: 0,
+		foxesscloud.VariablePvPower:              32.767,
+		foxesscloud.VariableInvTemperation:       41.6,
+		foxesscloud.VariableAmbientTemperation:   -12.5,
+		foxesscloud.VariableRunningState:         163,
+		foxesscloud.VariableCurrentFault:         17,
+		foxesscloud.VariableGeneration:           123456.7,
+		foxesscloud.VariableTodayYield:           18.4,
+	}
+	regs := NewRegisters()
+	regs.Set(1, EncodeVariables(values, FoxESSRegisters))
+	client := newTestClient(t, newTestServer(t, regs))
+
+	res, err := ReadVariables(context.Background(), client, 1, FoxESSRegisters)
+	if err != nil {
+		t.Fatalf("could not read variables: %v", err)
+	}
+	if len(res) != len(FoxESSRegisters) {
+		t.Errorf("expected %v variables, got %v", len(FoxESSRegisters), len(res))
+	}
+	for variable, want := range values {
+		if got := res[variable]; math.Abs(got-want) > 1e-9 {
+			t.Errorf("%v: expected %v, got %v", variable, want, got)
+		}
+	}
+	// registers not set read as zero
+	if got := res[foxesscloud.VariableSPower]; got != 0 {
+		t.Errorf("expected unset register to be zero, got %v", got)
+	}
+}
+
+func TestReadVariablesUnknownUnit(t *testing.T) {
+	client := newTestClient(t, newTestServer(t, NewRegisters()))
+
+	_, err := ReadVariables(context.Background(), client, 2, FoxESSRegisters)
+	var exc *ExceptionError
+	if !errors.As(err, &exc) || exc.Code != ExceptionIllegalDataAddress {
+		t.Fatalf("expected illegal data address exception, got %v", err)
+	}
+}
+
+func TestEncodeVariablesClamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		reg   Register
+		value float64
+		want  float64
+	}{
+		{name: "unsigned negative", reg: Register{Address: 1, Words: 1, Scale: 0.001}, value: -0.5, want: 0},
+		{name: "unsigned overflow", reg: Register{Address: 1, Words: 1, Scale: 0.001}, value: 70, want: 65.535},
+		{name: "signed underflow", reg: Register{Address: 1, Words: 1, Signed: true, Scale: 0.001}, value: -40, want: -32.768},
+		{name: "signed overflow", reg: Register{Address: 1, Words: 1, Signed: true, Scale: 0.001}, value: 40, want: 32.767},
+		{name: "double word negative", reg: Register{Address: 1, Words: 2, Signed: true, Scale: 0.1}, value: -5000.5, want: -5000.5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reg := test.reg
+			reg.Variable = foxesscloud.VariablePvPower
+			raw := EncodeVariables(map[foxesscloud.Variable]float64{reg.Variable: test.value}, []Register{reg})
+			words := make([]uint16, reg.Words)
+			for i := range words {
+				words[i] = raw[reg.Address+uint16(i)]
+			}
+			if got := decodeRegister(reg, words); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
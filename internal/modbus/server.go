@@ -0,0 +1,187 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+)
+
+// Handler serves register read requests, returning ExceptionError results in an exception response.
+type Handler interface {
+	ReadRegisters(unitID, function byte, address, quantity uint16) ([]uint16, error)
+}
+
+// Server is a Modbus TCP server supporting the register read functions.
+type Server struct {
+	handler Handler
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewServer(handler Handler) *Server {
+	return &Server{
+		handler: handler,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = ln.Close()
+		return net.ErrClosed
+	}
+	s.ln = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	for {
+		tid, unitID, pdu, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+		if err := writeFrame(conn, tid, unitID, s.handle(unitID, pdu)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(unitID byte, pdu []byte) []byte {
+	function := pdu[0]
+	switch function {
+	case FuncReadHoldingRegisters, FuncReadInputRegisters:
+	default:
+		return exception(function, ExceptionIllegalFunction)
+	}
+	if len(pdu) != 5 {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+
+	address := binary.BigEndian.Uint16(pdu[1:])
+	quantity := binary.BigEndian.Uint16(pdu[3:])
+	if quantity == 0 || quantity > MaxReadQuantity {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+
+	regs, err := s.handler.ReadRegisters(unitID, function, address, quantity)
+	if err != nil {
+		var errExc *ExceptionError
+		if errors.As(err, &errExc) {
+			return exception(function, errExc.Code)
+		}
+		return exception(function, ExceptionServerDeviceFailure)
+	}
+	if len(regs) != int(quantity) {
+		return exception(function, ExceptionServerDeviceFailure)
+	}
+
+	resp := make([]byte, 2+len(regs)*2)
+	resp[0] = function
+	resp[1] = byte(len(regs) * 2)
+	for i, v := range regs {
+		binary.BigEndian.PutUint16(resp[2+i*2:], v)
+	}
+	return resp
+}
+
+func exception(function, code byte) []byte {
+	return []byte{function | 0x80, code}
+}
+
+// Registers is a Handler serving register values stored in memory, separately for every unit.
+// Registers of a known unit which were never set read as zero.
+type Registers struct {
+	mu    sync.RWMutex
+	units map[byte]map[uint16]uint16
+}
+
+func NewRegisters() *Registers {
+	return &Registers{
+		units: make(map[byte]map[uint16]uint16),
+	}
+}
+
+// Set replaces all register values of the unit.
+func (r *Registers) Set(unitID byte, values map[uint16]uint16) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.units[unitID] = values
+}
+
+func (r *Registers) ReadRegisters(unitID, function byte, address, quantity uint16) ([]uint16, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	values, ok := r.units[unitID]
+	if !ok {
+		return nil, &ExceptionError{Function: function, Code: ExceptionIllegalDataAddress}
+	}
+	if int(address)+int(quantity) > 0x10000 {
+		return nil, &ExceptionError{Function: function, Code: ExceptionIllegalDataAddress}
+	}
+
+	regs := make([]uint16, quantity)
+	for i := range regs {
+		regs[i] = values[address+uint16(i)]
+	}
+	return regs, nil
+}
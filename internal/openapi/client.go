@@ -0,0 +1,294 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jbub/foxesscloud"
+)
+
+const (
+	DefaultBaseURL = "https://www.foxesscloud.com"
+
+	RealtimePath      = "/op/v0/device/real/query"
+	RealtimeBatchPath = "/op/v1/device/real/query"
+	HistoryPath       = "/op/v0/device/history/query"
+
+	// MaxBatchSize is the maximum number of inverters in a single batch realtime query.
+	MaxBatchSize = 50
+)
+
+// Config configures the Client.
+type Config struct {
+	Client    *http.Client
+	BaseURL   string
+	Token     string
+	UserAgent string
+}
+
+// NewClient creates a client for the Fox ESS open API. Unlike the foxesscloud package it supports
+// other base URLs, the batch and history endpoints and values which are not numbers, values are returned undecoded.
+func NewClient(cfg Config) *Client {
+	client := http.DefaultClient
+	if cfg.Client != nil {
+		client = cfg.Client
+	}
+	base := DefaultBaseURL
+	if cfg.BaseURL != "" {
+		base = strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	return &Client{
+		client:    client,
+		baseURL:   base,
+		token:     cfg.Token,
+		userAgent: cfg.UserAgent,
+	}
+}
+
+// ValidateBaseURL checks the base URL is an absolute URL.
+func ValidateBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("could not parse base url: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid base url: %v", baseURL)
+	}
+	return nil
+}
+
+type Client struct {
+	client    *http.Client
+	baseURL   string
+	token     string
+	userAgent string
+}
+
+const (
+	errNoNoError           = 0
+	errNoTokenExpired      = 41808
+	errNoTokenInvalid      = 41809
+	errHeadersMissing      = 40256
+	errBodyInvalid         = 40257
+	errRequestsTooFrequent = 40400
+	errRateLimitExceeded   = 40402
+)
+
+type RateLimitExceededError struct {
+	Msg string
+}
+
+func (e *RateLimitExceededError) Error() string {
+	return fmt.Sprintf("rate limit exceeded: %s", e.Msg)
+}
+
+type errorResponse struct {
+	ErrNo int    `json:"errno"`
+	Msg   string `json:"msg"`
+}
+
+// DataItem is a single variable reading with its value left undecoded,
+// the API returns numbers for most variables but strings for some (e.g. currentFault).
+type DataItem struct {
+	Unit     string               `json:"unit"`
+	Name     string               `json:"name"`
+	Variable foxesscloud.Variable `json:"variable"`
+	Value    json.RawMessage      `json:"value"`
+}
+
+// String returns the value as text, JSON strings are unquoted.
+func (i DataItem) String() string {
+	return rawString(i.Value)
+}
+
+type RealtimeData struct {
+	Datas    []DataItem                `json:"datas"`
+	Time     foxesscloud.DataTimestamp `json:"time"`
+	DeviceSN string                    `json:"deviceSN"`
+}
+
+type realtimeBatchRequest struct {
+	InverterSNs []string               `json:"sns"`
+	Variables   []foxesscloud.Variable `json:"variables"`
+}
+
+// GetRealtimeDataBatch returns the realtime data of up to MaxBatchSize inverters in a single request,
+// the result contains an item for every inverter known to the API.
+func (c *Client) GetRealtimeDataBatch(ctx context.Context, inverterSNs []string, variables []foxesscloud.Variable) ([]RealtimeData, error) {
+	if len(inverterSNs) > MaxBatchSize {
+		return nil, fmt.Errorf("too many inverters in batch: %v", len(inverterSNs))
+	}
+
+	var resp struct {
+		Result []RealtimeData `json:"result"`
+	}
+	pld := realtimeBatchRequest{
+		InverterSNs: inverterSNs,
+		Variables:   variables,
+	}
+	if err := c.post(ctx, RealtimeBatchPath, pld, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Result, nil
+}
+
+type realtimeRequest struct {
+	InverterSN string                 `json:"sn"`
+	Variables  []foxesscloud.Variable `json:"variables"`
+}
+
+func (c *Client) GetRealtimeData(ctx context.Context, inverterSN string, variables []foxesscloud.Variable) ([]RealtimeData, error) {
+	var resp struct {
+		Result []RealtimeData `json:"result"`
+	}
+	pld := realtimeRequest{
+		InverterSN: inverterSN,
+		Variables:  variables,
+	}
+	if err := c.post(ctx, RealtimePath, pld, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Result, nil
+}
+
+type HistoryPoint struct {
+	Time  foxesscloud.DataTimestamp `json:"time"`
+	Value json.RawMessage           `json:"value"`
+}
+
+// String returns the value as text, JSON strings are unquoted.
+func (p HistoryPoint) String() string {
+	return rawString(p.Value)
+}
+
+type HistoryItem struct {
+	Unit     string               `json:"unit"`
+	Name     string               `json:"name"`
+	Variable foxesscloud.Variable `json:"variable"`
+	Data     []HistoryPoint       `json:"data"`
+}
+
+type HistoryData struct {
+	Datas    []HistoryItem `json:"datas"`
+	DeviceSN string        `json:"deviceSN"`
+}
+
+type historyRequest struct {
+	InverterSN string                      `json:"sn"`
+	Variables  []foxesscloud.Variable      `json:"variables"`
+	Begin      *foxesscloud.QueryTimestamp `json:"begin,omitempty"`
+	End        *foxesscloud.QueryTimestamp `json:"end,omitempty"`
+}
+
+func (c *Client) GetHistoryData(ctx context.Context, inverterSN string, variables []foxesscloud.Variable, begin, end time.Time) ([]HistoryData, error) {
+	var resp struct {
+		Result []HistoryData `json:"result"`
+	}
+	pld := historyRequest{
+		InverterSN: inverterSN,
+		Variables:  variables,
+		Begin:      &foxesscloud.QueryTimestamp{Time: begin},
+		End:        &foxesscloud.QueryTimestamp{Time: end},
+	}
+	if err := c.post(ctx, HistoryPath, pld, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Result, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, pld any, res any) error {
+	body, err := json.Marshal(pld)
+	if err != nil {
+		return fmt.Errorf("could not marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range c.buildHeaders(path, time.Now()) {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("could not read response body: %w", err)
+	}
+
+	var errResp errorResponse
+	if err := json.Unmarshal(data, &errResp); err != nil {
+		return fmt.Errorf("could not unmarshal json response: %w", err)
+	}
+
+	switch errResp.ErrNo {
+	case errNoNoError:
+		break
+	case errNoTokenInvalid, errNoTokenExpired:
+		return fmt.Errorf("invalid token: %v", errResp.Msg)
+	case errHeadersMissing:
+		return fmt.Errorf("missing headers: %v", errResp.Msg)
+	case errBodyInvalid:
+		return fmt.Errorf("invalid body: %v", errResp.Msg)
+	case errRequestsTooFrequent, errRateLimitExceeded:
+		return &RateLimitExceededError{Msg: errResp.Msg}
+	default:
+		return fmt.Errorf("invalid response, got error code: %v, message: %v", errResp.ErrNo, errResp.Msg)
+	}
+
+	if err := json.Unmarshal(data, res); err != nil {
+		return fmt.Errorf("could not unmarshal json response: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) buildHeaders(path string, date time.Time) map[string]string {
+	timestamp := date.UnixMilli()
+	return map[string]string{
+		"content-type": "application/json",
+		"lang":         "en",
+		"timestamp":    strconv.FormatInt(timestamp, 10),
+		"user-agent":   c.userAgent,
+		"token":        c.token,
+		"signature":    Signature(c.token, path, timestamp),
+	}
+}
+
+// Signature computes the request signature expected by the Fox ESS open API.
+// The separators are the literal `\r\n` characters, not a CRLF sequence.
+func Signature(token string, path string, timestamp int64) string {
+	var b strings.Builder
+	b.WriteString(path)
+	b.WriteString("\\r\\n")
+	b.WriteString(token)
+	b.WriteString("\\r\\n")
+	b.WriteString(strconv.FormatInt(timestamp, 10))
+	hash := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(hash[:])
+}
+
+func rawString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	if string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
@@ -0,0 +1,136 @@
+package openapi
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/jbub/foxesscloud_exporter/internal/openapi"
+)
+
+// NewTracingTransport returns http.RoundTripper creating a span for every request attempt made by the next RoundTripper,
+// connection phases are recorded as span events and API error codes as span attributes.
+func NewTracingTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &tracingTransport{
+		next:   next,
+		tracer: otel.Tracer(tracerName),
+	}
+}
+
+type tracingTransport struct {
+	next   http.RoundTripper
+	tracer trace.Tracer
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Hostname()),
+			attribute.String("url.path", req.URL.Path),
+		),
+	)
+	defer span.End()
+
+	ctx = httptrace.WithClientTrace(ctx, clientTrace(span))
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	span.SetAttributes(attribute.Int("http.response.body.size", len(body)))
+
+	var errResp errorResponse
+	if json.Unmarshal(body, &errResp) == nil {
+		rateLimited := errResp.ErrNo == errRateLimitExceeded || errResp.ErrNo == errRequestsTooFrequent
+		span.SetAttributes(
+			attribute.Int("foxesscloud.errno", errResp.ErrNo),
+			attribute.Bool("foxesscloud.rate_limited", rateLimited),
+		)
+		if errResp.ErrNo != errNoNoError {
+			span.AddEvent("api error", trace.WithAttributes(
+				attribute.Int("foxesscloud.errno", errResp.ErrNo),
+				attribute.String("foxesscloud.msg", errResp.Msg),
+			))
+			span.SetStatus(codes.Error, fmt.Sprintf("api error code: %v", errResp.ErrNo))
+		}
+	}
+	return resp, nil
+}
+
+func clientTrace(span trace.Span) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			span.AddEvent("get conn", trace.WithAttributes(attribute.String("host_port", hostPort)))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.AddEvent("got conn", trace.WithAttributes(attribute.Bool("reused", info.Reused)))
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			span.AddEvent("dns start", trace.WithAttributes(attribute.String("host", info.Host)))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			attrs := []attribute.KeyValue{attribute.Int("addrs", len(info.Addrs))}
+			if info.Err != nil {
+				attrs = append(attrs, attribute.String("error", info.Err.Error()))
+			}
+			span.AddEvent("dns done", trace.WithAttributes(attrs...))
+		},
+		ConnectStart: func(network, addr string) {
+			span.AddEvent("connect start", trace.WithAttributes(attribute.String("addr", addr)))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			attrs := []attribute.KeyValue{attribute.String("addr", addr)}
+			if err != nil {
+				attrs = append(attrs, attribute.String("error", err.Error()))
+			}
+			span.AddEvent("connect done", trace.WithAttributes(attrs...))
+		},
+		TLSHandshakeStart: func() {
+			span.AddEvent("tls handshake start")
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			var attrs []attribute.KeyValue
+			if err != nil {
+				attrs = append(attrs, attribute.String("error", err.Error()))
+			}
+			span.AddEvent("tls handshake done", trace.WithAttributes(attrs...))
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			span.AddEvent("wrote request")
+		},
+		GotFirstResponseByte: func() {
+			span.AddEvent("got first response byte")
+		},
+	}
+}
@@ -0,0 +1,238 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	filePrefix = "foxesscloud-"
+	fileSuffix = ".jsonl"
+	fileTime   = "20060102T150405.000000000"
+)
+
+// Entry is a single recorded API request and its raw response.
+type Entry struct {
+	Time     time.Time       `json:"time"`
+	Duration time.Duration   `json:"duration"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// Config configures the Recorder.
+type Config struct {
+	// Dir is the directory where the archive files are written.
+	Dir string
+	// MaxFileSize is the size in bytes after which a new archive file is started.
+	MaxFileSize int64
+	// MaxFiles is the number of archive files kept, older files are removed.
+	MaxFiles int
+}
+
+// Recorder writes API responses to a rotating archive of JSON lines files.
+type Recorder struct {
+	cfg  Config
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func New(cfg Config) (*Recorder, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create record dir: %w", err)
+	}
+	return &Recorder{cfg: cfg}, nil
+}
+
+// Transport returns http.RoundTripper recording every response received by the next RoundTripper.
+func (r *Recorder) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{rec: r, next: next}
+}
+
+func (r *Recorder) Record(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("could not marshal entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil || (r.cfg.MaxFileSize > 0 && r.size+int64(len(data)) > r.cfg.MaxFileSize) {
+		if err := r.rotate(entry.Time); err != nil {
+			return err
+		}
+	}
+
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	return err
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *Recorder) rotate(now time.Time) error {
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+		r.file = nil
+	}
+
+	name := filepath.Join(r.cfg.Dir, filePrefix+now.UTC().Format(fileTime)+fileSuffix)
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not create record file: %w", err)
+	}
+	r.file = f
+	r.size = 0
+
+	if r.cfg.MaxFiles <= 0 {
+		return nil
+	}
+	files, err := archiveFiles(r.cfg.Dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > r.cfg.MaxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return fmt.Errorf("could not remove record file: %w", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+type transport struct {
+	rec  *Recorder
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		reqBody, err = io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	// recording is best effort, failing to write the archive must not fail the request
+	_ = t.rec.Record(Entry{
+		Time:     start,
+		Duration: time.Since(start),
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Request:  rawJSON(reqBody),
+		Status:   resp.StatusCode,
+		Response: rawJSON(respBody),
+	})
+	return resp, nil
+}
+
+// rawJSON embeds valid JSON as is, anything else is stored as a JSON string.
+func rawJSON(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	quoted, _ := json.Marshal(string(data))
+	return quoted
+}
+
+func archiveFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), filePrefix) && strings.HasSuffix(e.Name(), fileSuffix) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	// file names contain the creation time, sorting them by name sorts them by time
+	slices.Sort(files)
+	return files, nil
+}
+
+// Read calls fn for every entry in the archive in the order they were recorded.
+func Read(dir string, fn func(Entry) error) error {
+	files, err := archiveFiles(dir)
+	if err != nil {
+		return fmt.Errorf("could not list record files: %w", err)
+	}
+	for _, name := range files {
+		if err := readFile(name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(name string, fn func(Entry) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("could not unmarshal entry in %v: %w", name, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/jbub/foxesscloud_exporter/internal/collector"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
 )
 
 func getLandingPage(telemetryPath string) []byte {
@@ -21,13 +23,26 @@ func getLandingPage(telemetryPath string) []byte {
 	<body>
 	<h1>` + collector.Name + `</h1>
 	<p><a href="` + telemetryPath + `">Metrics</a></p>
+	<p><a href="/probe?target=">Probe</a></p>
 	</body>
 	</html>`)
 }
 
+const (
+	scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+	// leaves time to write the response before the scrape times out
+	scrapeTimeoutOffset = 500 * time.Millisecond
+)
+
 func New(cfg config.Config, exp *collector.Exporter) *HTTPServer {
 	reg := collector.NewRegistry(exp)
-	mux := newHTTPMux(reg, cfg.TelemetryPath)
+	units := exp.Units()
+	var telemetry http.Handler = newMetricsHandler(reg, units)
+	if cfg.APIFetchMode == config.FetchModeScrape {
+		telemetry = newScrapeHandler(exp, telemetry, cfg.APIFetchTimeout)
+	}
+	probe := newProbeHandler(exp, units, cfg.APIFetchTimeout)
+	mux := newHTTPMux(telemetry, probe, cfg.TelemetryPath)
 	srv := newHTTPServer(cfg.ListenAddress, mux)
 	return &HTTPServer{
 		srv: srv,
@@ -45,9 +60,88 @@ func newHTTPServer(listenAddr string, handler http.Handler) *http.Server {
 	}
 }
 
-func newHTTPMux(reg prometheus.Gatherer, telemetryPath string) *http.ServeMux {
+// newScrapeHandler refreshes the exporter data before serving the scrape, waiting at most for the scrape timeout
+// sent by Prometheus or the fetch timeout when the header is missing.
+func newScrapeHandler(exp *collector.Exporter, next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), scrapeTimeout(req, timeout))
+		exp.Refresh(ctx)
+		cancel()
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// newProbeHandler serves the metrics of a single inverter given by the target and account query parameters.
+func newProbeHandler(exp *collector.Exporter, units map[string]string, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		qry := req.URL.Query()
+		target := qry.Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), scrapeTimeout(req, timeout))
+		defer cancel()
+
+		probe, err := exp.Probe(ctx, qry.Get("account"), target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(probe)
+		newMetricsHandler(reg, units).ServeHTTP(w, req)
+	})
+}
+
+// newMetricsHandler serves the gathered metrics, OpenMetrics responses include the UNIT metadata of the metrics.
+func newMetricsHandler(reg prometheus.Gatherer, units map[string]string) http.Handler {
+	next := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		format := expfmt.NegotiateIncludingOpenMetrics(req.Header)
+		if format.FormatType() != expfmt.TypeOpenMetrics {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		mfs, err := reg.Gather()
+		if err != nil && len(mfs) == 0 {
+			http.Error(w, "could not gather metrics: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", string(format))
+		enc := expfmt.NewEncoder(w, format, expfmt.WithUnit())
+		for _, mf := range mfs {
+			if unit, ok := units[mf.GetName()]; ok {
+				mf.Unit = &unit
+			}
+			if err := enc.Encode(mf); err != nil {
+				return
+			}
+		}
+		if closer, ok := enc.(expfmt.Closer); ok {
+			_ = closer.Close()
+		}
+	})
+}
+
+func scrapeTimeout(req *http.Request, timeout time.Duration) time.Duration {
+	if v := req.Header.Get(scrapeTimeoutHeader); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+			return max(time.Duration(secs*float64(time.Second))-scrapeTimeoutOffset, 0)
+		}
+	}
+	return timeout
+}
+
+func newHTTPMux(telemetry http.Handler, probe http.Handler, telemetryPath string) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.Handle(telemetryPath, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.Handle(telemetryPath, telemetry)
+	mux.Handle("/probe", probe)
 	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
 		_, _ = w.Write(getLandingPage(telemetryPath))
 	})
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsHandlerUnits(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	power := prometheus.NewGauge(prometheus.GaugeOpts{Name: "foxesscloud_output_power_watts", Help: "Output power."})
+	energy := prometheus.NewCounter(prometheus.CounterOpts{Name: "foxesscloud_output_energy_joules_total", Help: "Output energy."})
+	legacy := prometheus.NewGauge(prometheus.GaugeOpts{Name: "foxesscloud_output_power_kw", Help: "Output power in kW."})
+	reg.MustRegister(power, energy, legacy)
+	units := map[string]string{
+		"foxesscloud_output_power_watts":         "watts",
+		"foxesscloud_output_energy_joules_total": "joules",
+	}
+
+	tests := []struct {
+		name    string
+		accept  string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "openmetrics",
+			accept: "application/openmetrics-text; version=1.0.0",
+			want: []string{
+				"# UNIT foxesscloud_output_power_watts watts\n",
+				"# UNIT foxesscloud_output_energy_joules joules\n",
+				"# EOF\n",
+			},
+			notWant: []string{"# UNIT foxesscloud_output_power_kw"},
+		},
+		{
+			name:    "text",
+			accept:  "text/plain",
+			want:    []string{"# TYPE foxesscloud_output_power_watts gauge\n"},
+			notWant: []string{"# UNIT"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Accept", test.accept)
+			rec := httptest.NewRecorder()
+			newMetricsHandler(reg, units).ServeHTTP(rec, req)
+
+			body := rec.Body.String()
+			for _, s := range test.want {
+				if !strings.Contains(body, s) {
+					t.Errorf("expected %q in response:\n%v", s, body)
+				}
+			}
+			for _, s := range test.notWant {
+				if strings.Contains(body, s) {
+					t.Errorf("expected no %q in response:\n%v", s, body)
+				}
+			}
+		})
+	}
+}
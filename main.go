@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/jbub/foxesscloud_exporter/cmd"
+	"github.com/jbub/foxesscloud_exporter/internal/config"
+	"github.com/jbub/foxesscloud_exporter/internal/openapi"
 
 	"github.com/prometheus/common/version"
 	"github.com/urfave/cli/v2"
@@ -29,16 +31,25 @@ func main() {
 				Value:   "/metrics",
 			},
 			&cli.StringFlag{
-				Name:     "inverters",
-				Usage:    "Comma separated list of inverter serial numbers.",
-				EnvVars:  []string{"INVERTERS"},
-				Required: true,
+				Name:    "inverters",
+				Usage:   "Comma separated list of inverter serial numbers fetched in the background, inverters can also be probed on demand.",
+				EnvVars: []string{"INVERTERS"},
 			},
 			&cli.StringFlag{
-				Name:     "api-token",
-				Usage:    "API token for the Fox ESS API.",
-				EnvVars:  []string{"API_TOKEN"},
-				Required: true,
+				Name:    "api-token",
+				Usage:   "API token for the Fox ESS API.",
+				EnvVars: []string{"API_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:    "api-accounts",
+				Usage:   "Comma separated list of additional named API tokens usable by probes. Format: name=token",
+				EnvVars: []string{"API_ACCOUNTS"},
+			},
+			&cli.StringFlag{
+				Name:    "api-url",
+				Usage:   "Base URL of the Fox ESS API.",
+				EnvVars: []string{"API_URL"},
+				Value:   openapi.DefaultBaseURL,
 			},
 			&cli.DurationFlag{
 				Name:    "api-fetch-interval",
@@ -48,10 +59,79 @@ func main() {
 			},
 			&cli.DurationFlag{
 				Name:    "api-fetch-timeout",
-				Usage:   "How long to wait for API fetch response.",
+				Usage:   "How long to wait for API fetch response of a single inverter.",
 				EnvVars: []string{"API_FETCH_TIMEOUT"},
 				Value:   time.Second * 5,
 			},
+			&cli.DurationFlag{
+				Name:    "api-fetch-cycle-timeout",
+				Usage:   "How long to wait for fetching all the inverters.",
+				EnvVars: []string{"API_FETCH_CYCLE_TIMEOUT"},
+				Value:   time.Second * 30,
+			},
+			&cli.IntFlag{
+				Name:    "api-fetch-concurrency",
+				Usage:   "How many inverters to fetch concurrently.",
+				EnvVars: []string{"API_FETCH_CONCURRENCY"},
+				Value:   4,
+			},
+			&cli.IntFlag{
+				Name:    "api-batch-size",
+				Usage:   "How many inverters to fetch in a single API request, at most 50. Values below 2 fetch every inverter separately.",
+				EnvVars: []string{"API_BATCH_SIZE"},
+				Value:   openapi.MaxBatchSize,
+			},
+			&cli.Float64Flag{
+				Name:    "api-rate-limit",
+				Usage:   "Maximum number of API requests per second, 0 disables the limit.",
+				EnvVars: []string{"API_RATE_LIMIT"},
+				Value:   1,
+			},
+			&cli.StringFlag{
+				Name:    "api-fetch-mode",
+				Usage:   "When to fetch the API, interval fetches every api-fetch-interval, scrape fetches when scraped.",
+				EnvVars: []string{"API_FETCH_MODE"},
+				Value:   config.FetchModeInterval,
+			},
+			&cli.DurationFlag{
+				Name:    "api-fetch-min-age",
+				Usage:   "Minimum age of the data before a scrape triggers a new fetch in the scrape fetch mode.",
+				EnvVars: []string{"API_FETCH_MIN_AGE"},
+				Value:   time.Second * 30,
+			},
+			&cli.BoolFlag{
+				Name:    "api-fetch-align",
+				Usage:   "Delay fetches until the next upstream refresh of the inverter data is expected.",
+				EnvVars: []string{"API_FETCH_ALIGN"},
+				Value:   true,
+			},
+			&cli.DurationFlag{
+				Name:    "api-fetch-night-interval",
+				Usage:   "How often to fetch the API outside daylight, requires site location.",
+				EnvVars: []string{"API_FETCH_NIGHT_INTERVAL"},
+				Value:   time.Minute * 15,
+			},
+			&cli.DurationFlag{
+				Name:    "api-fetch-ramp",
+				Usage:   "How long before sunrise and after sunset the fetch interval changes between day and night interval.",
+				EnvVars: []string{"API_FETCH_RAMP"},
+				Value:   time.Hour,
+			},
+			&cli.StringFlag{
+				Name:    "api-fetch-night-inverters",
+				Usage:   "Comma separated list of inverters fetched every api-fetch-interval also at night, e.g. battery systems.",
+				EnvVars: []string{"API_FETCH_NIGHT_INVERTERS"},
+			},
+			&cli.Float64Flag{
+				Name:    "site.latitude",
+				Usage:   "Latitude of the site in degrees between -90 and 90, used to compute sunrise and sunset.",
+				EnvVars: []string{"SITE_LATITUDE"},
+			},
+			&cli.Float64Flag{
+				Name:    "site.longitude",
+				Usage:   "Longitude of the site in degrees between -180 and 180, east is positive.",
+				EnvVars: []string{"SITE_LONGITUDE"},
+			},
 			&cli.StringFlag{
 				Name:    "log-level",
 				Usage:   "Default log level.",
@@ -63,9 +143,146 @@ func main() {
 				Usage:   "Default prometheus labels applied to all metrics. Format: label1=value1 label2=value2",
 				EnvVars: []string{"DEFAULT_LABELS"},
 			},
+			&cli.StringFlag{
+				Name:    "metric-naming",
+				Usage:   "Metric naming scheme, legacy, v2 or both. Legacy names are deprecated and will be removed, both exposes legacy and v2 metrics during migration.",
+				EnvVars: []string{"METRIC_NAMING"},
+				Value:   config.MetricNamingLegacy,
+			},
+			&cli.BoolFlag{
+				Name: "metric-timestamps",
+				Usage: "Expose inverter metrics with the time of the upstream reading instead of the scrape time. " +
+					"Readings older than 1h or older than an already exposed reading are left out, because Prometheus " +
+					"rejects too old and out of order samples. Metrics disappear from instant queries once the reading " +
+					"is older than the query lookback delta (5m by default), data_age_seconds is always exposed at the scrape time.",
+				EnvVars: []string{"METRIC_TIMESTAMPS"},
+			},
+			&cli.StringFlag{
+				Name:    "state-file",
+				Usage:   "Path to the file where the exporter state is persisted across restarts. Empty disables persistence.",
+				EnvVars: []string{"STATE_FILE"},
+			},
+			&cli.DurationFlag{
+				Name:    "state-save-interval",
+				Usage:   "How often the changed exporter state is persisted, the state is always persisted on shutdown.",
+				EnvVars: []string{"STATE_SAVE_INTERVAL"},
+				Value:   time.Minute,
+			},
+			&cli.DurationFlag{
+				Name:    "energy-max-gap",
+				Usage:   "Maximum gap between two power readings which is still integrated into energy counters.",
+				EnvVars: []string{"ENERGY_MAX_GAP"},
+				Value:   time.Minute * 15,
+			},
+			&cli.Float64Flag{
+				Name:    "efficiency.min-power",
+				Usage:   "Minimum DC power of the PV strings for which the inverter efficiency is computed, always in kW regardless of the metric naming.",
+				EnvVars: []string{"EFFICIENCY_MIN_POWER"},
+				Value:   0.3,
+			},
+			&cli.Float64Flag{
+				Name:    "efficiency.threshold",
+				Usage:   "Inverter efficiency ratio below which the inverter is flagged as running with low efficiency.",
+				EnvVars: []string{"EFFICIENCY_THRESHOLD"},
+				Value:   0.9,
+			},
+			&cli.StringFlag{
+				Name:    "local-inverters",
+				Usage:   "Comma separated list of inverters read over Modbus TCP when the cloud is unreachable. Format: sn=host:port[/unit]",
+				EnvVars: []string{"LOCAL_INVERTERS"},
+			},
+			&cli.IntFlag{
+				Name:    "local-unit-id",
+				Usage:   "Default Modbus unit id of the local inverters.",
+				EnvVars: []string{"LOCAL_UNIT_ID"},
+				Value:   247,
+			},
+			&cli.StringFlag{
+				Name:    "modbus.listen-address",
+				Usage:   "Address on which to expose inverter readings over Modbus TCP. Empty disables Modbus.",
+				EnvVars: []string{"MODBUS_LISTEN_ADDRESS"},
+			},
+			&cli.DurationFlag{
+				Name:    "modbus.stale-after",
+				Usage:   "Age after which readings exposed over Modbus are flagged as stale.",
+				EnvVars: []string{"MODBUS_STALE_AFTER"},
+				Value:   time.Minute * 15,
+			},
+			&cli.StringFlag{
+				Name:    "otlp.endpoint",
+				Usage:   "OTLP endpoint to push metrics to, either host:port or URL. Empty disables OTLP.",
+				EnvVars: []string{"OTLP_ENDPOINT"},
+			},
+			&cli.StringFlag{
+				Name:    "otlp.protocol",
+				Usage:   "OTLP protocol, grpc or http.",
+				EnvVars: []string{"OTLP_PROTOCOL"},
+				Value:   "grpc",
+			},
+			&cli.StringFlag{
+				Name:    "otlp.headers",
+				Usage:   "Comma separated list of headers sent with OTLP requests. Format: key=value",
+				EnvVars: []string{"OTLP_HEADERS"},
+			},
+			&cli.BoolFlag{
+				Name:    "otlp.insecure",
+				Usage:   "Disable TLS for OTLP requests.",
+				EnvVars: []string{"OTLP_INSECURE"},
+			},
+			&cli.StringFlag{
+				Name:    "otlp.ca-file",
+				Usage:   "CA certificate used to verify the OTLP endpoint.",
+				EnvVars: []string{"OTLP_CA_FILE"},
+			},
+			&cli.StringFlag{
+				Name:    "otlp.cert-file",
+				Usage:   "Client certificate used for OTLP requests.",
+				EnvVars: []string{"OTLP_CERT_FILE"},
+			},
+			&cli.StringFlag{
+				Name:    "otlp.key-file",
+				Usage:   "Client key used for OTLP requests.",
+				EnvVars: []string{"OTLP_KEY_FILE"},
+			},
+			&cli.DurationFlag{
+				Name:    "otlp.interval",
+				Usage:   "How often to push metrics to the OTLP endpoint.",
+				EnvVars: []string{"OTLP_INTERVAL"},
+				Value:   time.Minute,
+			},
+			&cli.BoolFlag{
+				Name:    "otlp.metrics",
+				Usage:   "Push metrics to the OTLP endpoint.",
+				EnvVars: []string{"OTLP_METRICS"},
+				Value:   true,
+			},
+			&cli.BoolFlag{
+				Name:    "otlp.traces",
+				Usage:   "Export traces of the API fetches to the OTLP endpoint.",
+				EnvVars: []string{"OTLP_TRACES"},
+			},
+			&cli.StringFlag{
+				Name:    "record-dir",
+				Usage:   "Directory where raw API responses are recorded for later replay. Empty disables recording.",
+				EnvVars: []string{"RECORD_DIR"},
+			},
+			&cli.Int64Flag{
+				Name:    "record-max-file-size",
+				Usage:   "Size in megabytes after which a new record file is started.",
+				EnvVars: []string{"RECORD_MAX_FILE_SIZE"},
+				Value:   64,
+			},
+			&cli.IntFlag{
+				Name:    "record-max-files",
+				Usage:   "Number of record files to keep, older files are removed.",
+				EnvVars: []string{"RECORD_MAX_FILES"},
+				Value:   10,
+			},
 		},
 		Commands: []*cli.Command{
 			cmd.Server,
+			cmd.Simulate,
+			cmd.Replay,
 		},
 		Version: version.Info(),
 	}